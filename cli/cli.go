@@ -9,7 +9,9 @@ import (
 	"os"
 
 	"github.com/harness/runner/cli/install"
+	"github.com/harness/runner/cli/mockmanager"
 	"github.com/harness/runner/cli/server"
+	"github.com/harness/runner/cli/tasks"
 	"github.com/harness/runner/version"
 
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -24,6 +26,8 @@ func Command() {
 	app.VersionFlag.Short('v')
 	server.Register(app, initSystem)
 	install.RegisterCommands(app)
+	tasks.RegisterCommands(app)
+	mockmanager.RegisterCommands(app)
 
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 }
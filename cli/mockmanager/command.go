@@ -0,0 +1,101 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package mockmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/harness/runner/delegateshell/mockmanager"
+	"github.com/harness/runner/logger"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type mockManagerCommand struct {
+	bind      string
+	accountID string
+	scenario  string
+	exit      bool
+}
+
+// RegisterCommands registers the command starting a fake manager, to test runners without a Harness environment
+func RegisterCommands(app *kingpin.Application) {
+	c := new(mockManagerCommand)
+	cmd := app.Command("mock-manager", "Start a fake Harness manager for integration testing. "+
+		"Tasks are enqueued and faults injected with a scenario or the /mock endpoints.").
+		Action(c.run)
+	cmd.Flag("bind", "address to listen on").
+		Default(":3460").
+		StringVar(&c.bind)
+	cmd.Flag("account-id", "account ID the runners use").
+		Default("mock-account").
+		StringVar(&c.accountID)
+	cmd.Flag("scenario", "JSON scenario to run once the manager is up").
+		StringVar(&c.scenario)
+	cmd.Flag("exit", "stop the manager once the scenario completes, with an error if it failed").
+		BoolVar(&c.exit)
+}
+
+func (c *mockManagerCommand) run(*kingpin.ParseContext) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	var scenario *mockmanager.Scenario
+	if c.scenario != "" {
+		s, err := mockmanager.LoadScenario(c.scenario)
+		if err != nil {
+			return err
+		}
+		scenario = s
+	}
+
+	m := mockmanager.New(c.accountID)
+	srv := &http.Server{Addr: c.bind, Handler: m.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+	logger.Infof(ctx, "Mock manager listening on %s for account %s", c.bind, c.accountID)
+
+	scenarioErr := make(chan error, 1)
+	if scenario != nil {
+		go func() {
+			scenarioErr <- m.Run(ctx, scenario)
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-serveErr:
+	case err = <-scenarioErr:
+		if err != nil {
+			logger.WithError(ctx, err).Errorln("scenario failed")
+		} else {
+			logger.Infoln(ctx, "scenario completed")
+		}
+		if !c.exit {
+			err = nil
+			select {
+			case <-ctx.Done():
+			case err = <-serveErr:
+			}
+		}
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	_ = srv.Shutdown(shutdownCtx)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("mock manager: %w", err)
+	}
+	return nil
+}
@@ -69,7 +69,10 @@ func (c *serverCommand) run(*kingpin.ParseContext) error {
 		return fmt.Errorf("encountered an error while wiring the system: %w", err)
 	}
 
-	remotelogger.Start(ctx, loadedConfig.Delegate.AccountID, loadedConfig.GetHarnessUrl(), loadedConfig.GetToken(), serviceName, loadedConfig.GetName(), loadedConfig.EnableRemoteLogging, loadedConfig.Server.Insecure)
+	// Rotates the runner token when the token file changes
+	go system.tokens.Watch(ctx)
+
+	remotelogger.Start(ctx, loadedConfig.Delegate.AccountID, loadedConfig.GetHarnessUrls(), system.tokens, serviceName, loadedConfig.GetName(), loadedConfig.EnableRemoteLogging, loadedConfig.Server.Insecure, loadedConfig.GetClientCertificate())
 	defer func() {
 		err := logger.CloseHooks()
 		if err != nil {
@@ -110,6 +113,17 @@ func (c *serverCommand) run(*kingpin.ParseContext) error {
 	// Start Metrics endpoint handler
 	system.metricsHandler.Handle()
 
+	// Start task journal endpoint handler
+	system.delegate.Journal.Handle(loadedConfig.Journal.Endpoint)
+
+	// Start runner stats endpoint handler
+	system.delegate.Stats.Handle(loadedConfig.Stats.Endpoint)
+
+	// Start shadow compatibility report endpoint handler
+	if loadedConfig.Shadow.Enabled {
+		system.delegate.Shadow.Handle(loadedConfig.Shadow.Endpoint)
+	}
+
 	logger.Infoln(ctx, "Runner configurations loaded")
 
 	runnerInfo, err := system.delegate.Register(ctx)
@@ -144,6 +158,14 @@ func (c *serverCommand) run(*kingpin.ParseContext) error {
 		return system.delegate.StartRunnerProcesses(ctx)
 	})
 
+	// The standalone task API has its own listener, it's not exposed along with the other endpoints
+	if loadedConfig.Standalone.Enabled {
+		g.Go(func() error {
+			s := loadedConfig.Standalone
+			return system.delegate.Standalone.Serve(ctx, s.Bind, s.Endpoint, s.Token)
+		})
+	}
+
 	g.Go(func() error {
 		if err := startHTTPServer(ctx, loadedConfig); err != nil {
 			if errors.Is(err, context.Canceled) || errors.Is(err, http.ErrServerClosed) {
@@ -3,6 +3,7 @@ package server
 import (
 	"github.com/drone-runners/drone-runner-aws/app/drivers"
 	"github.com/harness/runner/delegateshell"
+	"github.com/harness/runner/delegateshell/delegate"
 	metricshandler "github.com/harness/runner/metrics/handler"
 )
 
@@ -11,16 +12,19 @@ type System struct {
 	delegate       *delegateshell.DelegateShell
 	poolManager    drivers.IManager
 	metricsHandler *metricshandler.MetricsHandler
+	tokens         *delegate.TokenSource
 }
 
 func NewSystem(
 	delegate *delegateshell.DelegateShell,
 	poolManager drivers.IManager,
 	metricsHandler *metricshandler.MetricsHandler,
+	tokens *delegate.TokenSource,
 ) *System {
 	return &System{
 		delegate:       delegate,
 		poolManager:    poolManager,
 		metricsHandler: metricsHandler,
+		tokens:         tokens,
 	}
 }
@@ -0,0 +1,116 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package tasks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/harness/godotenv/v3"
+	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/delegateshell/journal"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type tasksCommand struct {
+	envFile   string
+	status    string
+	taskType  string
+	accountID string
+	since     time.Duration
+	limit     int
+	taskID    string
+}
+
+// RegisterCommands registers the commands querying the local journal of the tasks executed by the runner
+func RegisterCommands(app *kingpin.Application) {
+	c := new(tasksCommand)
+	cmd := app.Command("tasks", "Query the tasks executed by the runner.")
+	cmd.Flag("env-file", "environment file").
+		Default(".env").
+		StringVar(&c.envFile)
+
+	listCmd := cmd.Command("list", "List the tasks executed by the runner, most recent first.").
+		Action(c.list)
+	listCmd.Flag("status", "only list the tasks with this status (RUNNING, OK, FAILED, ABORTED)").
+		StringVar(&c.status)
+	listCmd.Flag("type", "only list the tasks of this type").
+		StringVar(&c.taskType)
+	listCmd.Flag("account", "only list the tasks of this account").
+		StringVar(&c.accountID)
+	listCmd.Flag("since", "only list the tasks started within this duration, e.g. 24h").
+		DurationVar(&c.since)
+	listCmd.Flag("limit", "maximum number of tasks to list").
+		Default("50").
+		IntVar(&c.limit)
+
+	showCmd := cmd.Command("show", "Show the record of a task.").
+		Action(c.show)
+	showCmd.Arg("task-id", "task ID").
+		Required().
+		StringVar(&c.taskID)
+}
+
+func (c *tasksCommand) list(*kingpin.ParseContext) error {
+	j, err := c.journal()
+	if err != nil {
+		return err
+	}
+	f := journal.Filter{Status: c.status, TaskType: c.taskType, AccountID: c.accountID, Limit: c.limit}
+	if c.since > 0 {
+		f.Since = time.Now().Add(-c.since)
+	}
+	records, err := j.List(f)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK ID\tTYPE\tACCOUNT\tSTATUS\tSTARTED\tDURATION\tRESPONSE SIZE")
+	for _, r := range records {
+		duration := "-"
+		if r.EndedAt != nil {
+			duration = r.EndedAt.Sub(r.StartedAt).Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n", r.TaskID, r.TaskType, r.AccountID, r.Status,
+			r.StartedAt.Format(time.RFC3339), duration, r.ResponseSize)
+	}
+	return w.Flush()
+}
+
+func (c *tasksCommand) show(*kingpin.ParseContext) error {
+	j, err := c.journal()
+	if err != nil {
+		return err
+	}
+	r, err := j.Get(c.taskID)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+// journal opens the journal of the runner configured by the environment
+func (c *tasksCommand) journal() (*journal.Journal, error) {
+	if c.envFile != "" {
+		if err := godotenv.Load(c.envFile); err != nil {
+			logrus.WithError(err).Debugln("cannot load env file")
+		}
+	}
+	config, err := delegate.FromEnviron()
+	if err != nil {
+		return nil, fmt.Errorf("could not load runner config: %w", err)
+	}
+	return journal.FromConfig(config), nil
+}
@@ -12,8 +12,15 @@ import (
 	"github.com/harness/runner/delegateshell/client"
 	"github.com/harness/runner/delegateshell/daemonset"
 	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/delegateshell/filter"
 	"github.com/harness/runner/delegateshell/heartbeat"
+	"github.com/harness/runner/delegateshell/journal"
+	"github.com/harness/runner/delegateshell/lease"
+	"github.com/harness/runner/delegateshell/outbox"
 	"github.com/harness/runner/delegateshell/poller"
+	"github.com/harness/runner/delegateshell/shadow"
+	"github.com/harness/runner/delegateshell/standalone"
+	"github.com/harness/runner/delegateshell/stats"
 	vmmetrics "github.com/harness/runner/delegateshell/vm/metrics"
 	"github.com/harness/runner/delegateshell/vm/pool"
 	"github.com/harness/runner/delegateshell/vm/store"
@@ -28,8 +35,16 @@ func initSystem(ctx context.Context, config *delegate.Config) (*server.System, e
 		router.WireSet,
 		delegateshell.WireSet,
 		client.WireSet,
+		delegate.WireSet,
 		poller.WireSet,
 		heartbeat.WireSet,
+		outbox.WireSet,
+		filter.WireSet,
+		journal.WireSet,
+		lease.WireSet,
+		shadow.WireSet,
+		standalone.WireSet,
+		stats.WireSet,
 		metricsinjection.WireSet,
 
 		// Dependencies required for managing VMs.
@@ -13,8 +13,15 @@ import (
 	"github.com/harness/runner/delegateshell/client"
 	"github.com/harness/runner/delegateshell/daemonset"
 	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/delegateshell/filter"
 	"github.com/harness/runner/delegateshell/heartbeat"
+	"github.com/harness/runner/delegateshell/journal"
+	"github.com/harness/runner/delegateshell/lease"
+	"github.com/harness/runner/delegateshell/outbox"
 	"github.com/harness/runner/delegateshell/poller"
+	"github.com/harness/runner/delegateshell/shadow"
+	"github.com/harness/runner/delegateshell/standalone"
+	"github.com/harness/runner/delegateshell/stats"
 	"github.com/harness/runner/delegateshell/vm/metrics"
 	"github.com/harness/runner/delegateshell/vm/pool"
 	"github.com/harness/runner/delegateshell/vm/store"
@@ -25,7 +32,11 @@ import (
 // Injectors from wire.go:
 
 func initSystem(ctx context.Context, config *delegate.Config) (*server.System, error) {
-	clientClient := client.ProvideManagerClient(config)
+	tokenSource := delegate.NewTokenSource(config)
+	metricsMetrics := metricsinjection.ProvideMetricsClient(config)
+	managerClient := client.ProvideManagerClient(config, tokenSource, metricsMetrics)
+	standaloneServer := standalone.ProvideServer(config)
+	clientClient := standalone.ProvideClient(config, managerClient, standaloneServer)
 	downloader, err := delegateshell.ProvideDownloader(config)
 	if err != nil {
 		return nil, err
@@ -34,7 +45,7 @@ func initSystem(ctx context.Context, config *delegate.Config) (*server.System, e
 	if err != nil {
 		return nil, err
 	}
-	daemonSetManager := daemonset.ProvideDaemonSetManager(config, downloader)
+	daemonSetManager := daemonset.ProvideDaemonSetManager(config, tokenSource, downloader)
 	db, err := store.ProvideSQLDatabase(config)
 	if err != nil {
 		return nil, err
@@ -42,17 +53,25 @@ func initSystem(ctx context.Context, config *delegate.Config) (*server.System, e
 	instanceStore := store.ProvideInstanceStore(db)
 	stageOwnerStore := store.ProvideStageOwnerStore(db)
 	iManager := pool.ProvideManager(ctx, instanceStore, stageOwnerStore, config)
-	metricsMetrics := metricsinjection.ProvideMetricsClient(config)
 	metricMetrics, err := metrics.ProvideVMMetrics(ctx, metricsMetrics, instanceStore, config)
 	if err != nil {
 		return nil, err
 	}
-	taskRouter := router.ProvideRouter(config, downloader, packageLoader, daemonSetManager, iManager, stageOwnerStore, metricMetrics)
-	daemonSetReconciler := daemonset.ProvideDaemonSetReconciler(daemonSetManager, taskRouter, clientClient, metricsMetrics)
-	pollerPoller := poller.ProvidePoller(clientClient, taskRouter, config, metricsMetrics)
+	taskRouter := router.ProvideRouter(config, tokenSource, downloader, packageLoader, daemonSetManager, iManager, stageOwnerStore, metricMetrics, metricsMetrics)
+	daemonSetReconciler := daemonset.ProvideDaemonSetReconciler(daemonSetManager, tokenSource, taskRouter, clientClient, metricsMetrics)
+	outboxOutbox := outbox.ProvideOutbox(config, clientClient)
+	journalJournal := journal.ProvideJournal(config)
+	leaseStore := lease.ProvideStore(config)
+	rules, err := filter.ProvideRules(config)
+	if err != nil {
+		return nil, err
+	}
+	pollerPoller := poller.ProvidePoller(clientClient, outboxOutbox, journalJournal, leaseStore, taskRouter, config, metricsMetrics, rules)
 	keepAlive := heartbeat.ProvideKeepAlive(config, clientClient, metricsMetrics)
-	delegateShell := delegateshell.ProvideDelegateShell(config, clientClient, taskRouter, daemonSetManager, daemonSetReconciler, downloader, pollerPoller, keepAlive)
+	shadowShadow := shadow.ProvideShadow(config, clientClient)
+	collector := stats.ProvideCollector(config, pollerPoller, daemonSetManager, iManager)
+	delegateShell := delegateshell.ProvideDelegateShell(config, clientClient, taskRouter, daemonSetManager, daemonSetReconciler, downloader, pollerPoller, keepAlive, outboxOutbox, journalJournal, leaseStore, shadowShadow, standaloneServer, collector)
 	metricsHandler := metricsinjection.ProvideMetricsHandler(config)
-	system := server.NewSystem(delegateShell, iManager, metricsHandler)
+	system := server.NewSystem(delegateShell, iManager, metricsHandler, tokenSource)
 	return system, nil
 }
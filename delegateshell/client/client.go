@@ -26,6 +26,9 @@ type Client interface {
 	// SendStatus sends a response to the task server for a task ID
 	SendStatus(ctx context.Context, delegateID, taskID string, req *TaskResponse) error
 
+	// SendProgress sends an intermediate progress event to the task server for a running task ID
+	SendProgress(ctx context.Context, delegateID, taskID string, req *TaskProgress) error
+
 	// Unregister registers the runner with the task server
 	Unregister(ctx context.Context, r *UnregisterRequest) error
 
@@ -36,3 +39,22 @@ type Client interface {
 
 	GetLoggingToken(ctx context.Context) (*AccessTokenBean, error)
 }
+
+// PayloadReader is implemented by the clients with read-only access to the task payloads.
+type PayloadReader interface {
+	// ReadExecutionPayload returns the payload of a task without acquiring it
+	ReadExecutionPayload(ctx context.Context, taskID string) (*RunnerAcquiredTasks, error)
+}
+
+// Streamer is implemented by the clients to which the manager can push the runner events over a persistent connection.
+type Streamer interface {
+	// StreamRunnerEvents opens the event stream of a runner over the given transport, "websocket" or "sse"
+	StreamRunnerEvents(ctx context.Context, runnerID, transport string) (EventStream, error)
+}
+
+// EventStream is a persistent connection on which the manager pushes messages to the runner.
+type EventStream interface {
+	// Recv blocks until the next message arrives. It returns an error once the connection is lost.
+	Recv() (*StreamMessage, error)
+	Close() error
+}
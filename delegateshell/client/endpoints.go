@@ -0,0 +1,199 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/logger"
+	"github.com/harness/runner/utils"
+	"github.com/pkg/errors"
+)
+
+var (
+	defaultFailover = delegate.FailoverConfig{FailureThreshold: 3, Cooldown: 30 * time.Second}
+	// Weight of the latest request in the average latency of an endpoint
+	latencyWeight = 0.2
+)
+
+// managerEndpoint is an endpoint of the manager along with its health
+type managerEndpoint struct {
+	url string
+	// number of consecutive failures
+	failures int
+	// moving average of the latency of the requests
+	latency time.Duration
+	// the endpoint is not used until then, unless all the endpoints are down
+	downUntil time.Time
+	// the runner registration was sent through this endpoint
+	registered bool
+}
+
+type noLatencyKey struct{}
+
+// withoutLatency marks the requests which are held open by the manager, their latency says nothing of the endpoint
+func withoutLatency(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noLatencyKey{}, true)
+}
+
+// endpoint returns the endpoint the requests go to: the first endpoint which is up, in order of preference.
+// A down endpoint is back in the rotation once its cooldown is over, so the runner fails back to the primary
+// endpoint as soon as it recovers.
+func (p *ManagerClient) endpoint(ctx context.Context) *managerEndpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	var next *managerEndpoint
+	for _, e := range p.endpoints {
+		if !now.Before(e.downUntil) {
+			next = e
+			break
+		}
+	}
+	if next == nil {
+		// All the endpoints are down, the one recovering first gets the request
+		next = p.endpoints[0]
+		for _, e := range p.endpoints[1:] {
+			if e.downUntil.Before(next.downUntil) {
+				next = e
+			}
+		}
+	}
+	if next == p.active {
+		return next
+	}
+	switch {
+	case p.active == nil:
+		logger.Infof(ctx, "Using manager endpoint %s", next.url)
+	case p.precedes(next, p.active):
+		logger.Infof(ctx, "Manager endpoint %s recovered, failing back from %s", next.url, p.active.url)
+	default:
+		logger.Warnf(ctx, "Manager endpoint %s is down, failing over to %s", p.active.url, next.url)
+	}
+	if p.Metrics != nil {
+		if p.active != nil {
+			p.Metrics.SetManagerEndpointActive(p.active.url, p.RunnerName, false)
+		}
+		p.Metrics.SetManagerEndpointActive(next.url, p.RunnerName, true)
+	}
+	p.active = next
+	return next
+}
+
+// precedes tells whether endpoint a comes before endpoint b in order of preference
+func (p *ManagerClient) precedes(a, b *managerEndpoint) bool {
+	for _, e := range p.endpoints {
+		switch e {
+		case a:
+			return true
+		case b:
+			return false
+		}
+	}
+	return false
+}
+
+// report updates the health of an endpoint with the outcome of a request. It returns whether the request failed
+// because of the endpoint, in which case it can be sent to another endpoint.
+func (p *ManagerClient) report(ctx context.Context, e *managerEndpoint, res *http.Response, err error, latency time.Duration) bool {
+	if ctx.Err() != nil {
+		// The request was given up by the runner
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err != nil && (res == nil || res.StatusCode >= http.StatusInternalServerError) {
+		e.failures++
+		if e.failures >= p.Failover.FailureThreshold {
+			e.downUntil = time.Now().Add(p.Failover.Cooldown)
+			logger.WithError(ctx, err).Warnf("manager endpoint %s failed %d times in a row, it's down for %s",
+				e.url, e.failures, p.Failover.Cooldown)
+		}
+		return true
+	}
+	e.failures = 0
+	if ctx.Value(noLatencyKey{}) != nil || latency <= 0 {
+		return false
+	}
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(e.latency))
+	}
+	if p.Failover.LatencyThreshold > 0 && e.latency > p.Failover.LatencyThreshold && len(p.endpoints) > 1 {
+		logger.Warnf(ctx, "manager endpoint %s is slow, average latency %s, it's down for %s",
+			e.url, e.latency, p.Failover.Cooldown)
+		e.downUntil = time.Now().Add(p.Failover.Cooldown)
+		// The endpoint starts afresh after the cooldown
+		e.latency = 0
+	}
+	return false
+}
+
+// client returns the HTTP client of an endpoint
+func (p *ManagerClient) client(e *managerEndpoint) *utils.HTTPClient {
+	return &utils.HTTPClient{Client: p.Client, Endpoint: e.url, SkipVerify: p.SkipVerify}
+}
+
+// registered records the registration of the runner. The endpoint which took it is the only one which
+// knows the runner, the registration is sent again to the other endpoints before they are used.
+func (p *ManagerClient) registered(ctx context.Context, r *RegisterRequest, runnerID string) {
+	registration := *r
+	registration.ID = runnerID
+	current := p.endpoint(ctx)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.registration = &registration
+	for _, e := range p.endpoints {
+		e.registered = e == current
+	}
+}
+
+// unregistered forgets the registration of the runner
+func (p *ManagerClient) unregistered() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.registration = nil
+}
+
+// syncRegistration registers the runner through an endpoint which did not take its registration yet, keeping the
+// ID the runner was given. Failing over to an endpoint in another region does not lose the runner that way.
+func (p *ManagerClient) syncRegistration(ctx context.Context, e *managerEndpoint, headers map[string]string) (*http.Response, error) {
+	p.mu.Lock()
+	registration := p.registration
+	if registration == nil || e.registered {
+		p.mu.Unlock()
+		return nil, nil
+	}
+	p.mu.Unlock()
+
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(registration); err != nil {
+		return nil, err
+	}
+	res, body, err := p.client(e).Do(ctx, fmt.Sprintf(registerEndpoint, p.AccountID), "POST", headers, buf)
+	if err != nil {
+		return res, errors.Wrapf(err, "could not register the runner through manager endpoint %s", e.url)
+	}
+	resp := &RegisterResponse{}
+	if err := json.Unmarshal(body, resp); err == nil && resp.Resource.DelegateID != "" && resp.Resource.DelegateID != registration.ID {
+		logger.Errorf(ctx, "manager endpoint %s registered the runner as %s instead of %s", e.url, resp.Resource.DelegateID, registration.ID)
+	}
+	p.mu.Lock()
+	// The runner may have unregistered in the meantime
+	if p.registration == registration {
+		e.registered = true
+	}
+	p.mu.Unlock()
+	logger.Infof(ctx, "Registered runner %s through manager endpoint %s", registration.ID, e.url)
+	return res, nil
+}
@@ -11,11 +11,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/harness/runner/logger"
+	"github.com/harness/runner/metrics"
 
-	"github.com/cenkalti/backoff/v4"
 	"github.com/harness/runner/delegateshell/delegate"
 	"github.com/harness/runner/utils"
 )
@@ -25,17 +26,18 @@ const (
 	unregisterEndpoint              = "/api/agent/delegates/unregister?accountId=%s"
 	heartbeatEndpoint               = "/api/agent/delegates/heartbeat-with-polling?accountId=%s"
 	runnerEventsPollEndpoint        = "/api/executions/%s/runner-events?accountId=%s"
+	runnerEventsLongPollParam       = "&waitSeconds=%d"
+	runnerEventsStreamEndpoint      = "/api/executions/%s/runner-events/stream?accountId=%s"
 	executionPayloadEndpoint        = "/api/executions/%s/request?delegateId=%s&accountId=%s&delegateInstanceId=%s&delegateName=%s"
 	taskStatusEndpoint              = "/api/executions/%s/task-response?runnerId=%s&accountId=%s"
+	taskProgressEndpoint            = "/api/executions/%s/task-progress?runnerId=%s&accountId=%s"
 	daemonSetReconcileEndpoint      = "/api/daemons/%s/reconcile?accountId=%s"
 	acquireDaemonTasksEndpoint      = "/api/daemons/%s/tasks?accountId=%s"
 	stackDriverLoggingTokenEndpoint = "/api/agent/infra-download/delegate-auth/delegate/logging-token?accountId=%s"
 )
 
 var (
-	registerTimeout      = 30 * time.Second
-	taskEventsTimeout    = 60 * time.Second
-	sendStatusRetryTimes = 5
+	taskEventsTimeout = 60 * time.Second
 )
 
 type ManagerClient struct {
@@ -43,14 +45,42 @@ type ManagerClient struct {
 	AccountID  string
 	Token      string
 	TokenCache *delegate.TokenCache
+	// If set, the manager holds the runner events request open for up to this long until events arrive
+	LongPoll time.Duration
+	// Failover between the endpoints of the manager
+	Failover delegate.FailoverConfig
+	// If set, the active endpoint is reported with the name of the runner
+	Metrics    metrics.Metrics
+	RunnerName string
+
+	mu sync.Mutex
+	// endpoints of the manager in order of preference, the embedded client holds the primary endpoint
+	endpoints []*managerEndpoint
+	active    *managerEndpoint
+	// the last registration of the runner, sent again to the endpoints which did not take it
+	registration *RegisterRequest
 }
 
-func NewManagerClient(endpoint, accountID, secret string, skipverify bool, additionalCertsDir string) *ManagerClient {
-	return &ManagerClient{
-		HTTPClient: *utils.New(endpoint, skipverify, additionalCertsDir),
+// NewManagerClient returns a client of the manager, which fails over between the endpoints in the given order.
+// The client certificate is optional.
+func NewManagerClient(endpoints []string, accountID, secret string, skipverify bool, additionalCertsDir string, cert *utils.ClientCertificate) *ManagerClient {
+	primary := ""
+	if len(endpoints) > 0 {
+		primary = endpoints[0]
+	}
+	c := &ManagerClient{
+		HTTPClient: *utils.NewWithClientCertificate(primary, skipverify, additionalCertsDir, cert),
 		AccountID:  accountID,
 		TokenCache: delegate.NewTokenCache(accountID, secret),
+		Failover:   defaultFailover,
+	}
+	for _, endpoint := range endpoints {
+		c.endpoints = append(c.endpoints, &managerEndpoint{url: endpoint})
+	}
+	if len(c.endpoints) == 0 {
+		c.endpoints = append(c.endpoints, &managerEndpoint{})
 	}
+	return c
 }
 
 // ReconcileDaemonSets calls the daemon set reconciliation endpoint in manager
@@ -58,7 +88,7 @@ func (p *ManagerClient) ReconcileDaemonSets(ctx context.Context, runnerId string
 	req := r
 	resp := &DaemonSetReconcileResponse{}
 	path := fmt.Sprintf(daemonSetReconcileEndpoint, runnerId, p.AccountID)
-	_, err := p.doJson(ctx, path, "POST", req, resp)
+	_, err := p.retry(ctx, requestReconcile, path, "POST", req, resp) //nolint: bodyclose
 	return resp, err
 }
 
@@ -67,7 +97,7 @@ func (p *ManagerClient) AcquireDaemonTasks(ctx context.Context, runnerId string,
 	req := r
 	resp := &RunnerAcquiredTasks{}
 	path := fmt.Sprintf(acquireDaemonTasksEndpoint, runnerId, p.AccountID)
-	_, err := p.retry(ctx, path, "POST", req, resp, createBackoff(ctx, registerTimeout), false) //nolint: bodyclose
+	_, err := p.retry(ctx, requestAcquireDaemon, path, "POST", req, resp) //nolint: bodyclose
 	return resp, err
 }
 
@@ -76,7 +106,10 @@ func (p *ManagerClient) Register(ctx context.Context, r *RegisterRequest) (*Regi
 	req := r
 	resp := &RegisterResponse{}
 	path := fmt.Sprintf(registerEndpoint, p.AccountID)
-	_, err := p.retry(ctx, path, "POST", req, resp, createBackoff(ctx, registerTimeout), true) //nolint: bodyclose
+	_, err := p.retry(ctx, requestRegister, path, "POST", req, resp) //nolint: bodyclose
+	if err == nil {
+		p.registered(ctx, req, resp.Resource.DelegateID)
+	}
 	return resp, err
 }
 
@@ -84,7 +117,10 @@ func (p *ManagerClient) Register(ctx context.Context, r *RegisterRequest) (*Regi
 func (p *ManagerClient) Unregister(ctx context.Context, r *UnregisterRequest) error {
 	req := r
 	path := fmt.Sprintf(unregisterEndpoint, p.AccountID)
-	_, err := p.retry(ctx, path, "POST", req, nil, createBackoff(ctx, registerTimeout), true)
+	_, err := p.retry(ctx, requestUnregister, path, "POST", req, nil) //nolint: bodyclose
+	if err == nil {
+		p.unregistered()
+	}
 	return err
 }
 
@@ -92,15 +128,36 @@ func (p *ManagerClient) Unregister(ctx context.Context, r *UnregisterRequest) er
 func (p *ManagerClient) Heartbeat(ctx context.Context, r *RegisterRequest) error {
 	req := r
 	path := fmt.Sprintf(heartbeatEndpoint, p.AccountID)
-	_, err := p.doJson(ctx, path, "POST", req, nil)
+	res, err := p.retry(ctx, requestHeartbeat, path, "POST", req, nil) //nolint: bodyclose
+	if err != nil && res != nil && res.StatusCode > 299 {
+		return &StatusError{StatusCode: res.StatusCode, Err: err}
+	}
 	return err
 }
 
+// StatusError is the error of a request the manager answered with an unsuccessful status code
+type StatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *StatusError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
 // GetRunnerEvents gets a list of events which can be executed on this runner
 func (p *ManagerClient) GetRunnerEvents(ctx context.Context, id string) (*RunnerEventsResponse, error) {
 	path := fmt.Sprintf(runnerEventsPollEndpoint, id, p.AccountID)
+	if p.LongPoll > 0 {
+		path += fmt.Sprintf(runnerEventsLongPollParam, int(p.LongPoll.Seconds()))
+		ctx = withoutLatency(ctx)
+	}
 	events := &RunnerEventsResponse{}
-	_, err := p.doJson(ctx, path, "GET", nil, events)
+	_, err := p.retry(ctx, requestRunnerEvents, path, "GET", nil, events) //nolint: bodyclose
 	return events, err
 }
 
@@ -108,60 +165,36 @@ func (p *ManagerClient) GetRunnerEvents(ctx context.Context, id string) (*Runner
 func (p *ManagerClient) GetExecutionPayload(ctx context.Context, delegateID, delegateName, taskID string) (*RunnerAcquiredTasks, error) {
 	path := fmt.Sprintf(executionPayloadEndpoint, taskID, delegateID, p.AccountID, delegateID, delegateName)
 	payload := &RunnerAcquiredTasks{}
-	_, err := p.doJson(ctx, path, "GET", nil, payload)
+	_, err := p.retry(ctx, requestExecutionPayload, path, "GET", nil, payload) //nolint: bodyclose
 	if err != nil {
 		logger.WithError(ctx, err).Error("Error making http call")
 	}
 	return payload, err
 }
 
-// SendStatus updates the status of a task
+// SendStatus updates the status of a task. If the manager answers with an unsuccessful status code, the error
+// is a *StatusError.
 func (p *ManagerClient) SendStatus(ctx context.Context, delegateID, taskID string, r *TaskResponse) error {
 	path := fmt.Sprintf(taskStatusEndpoint, taskID, delegateID, p.AccountID)
 	req := r
-	_, err := p.doJson(ctx, path, "POST", req, nil)
+	res, err := p.retry(ctx, requestTaskResponse, path, "POST", req, nil) //nolint: bodyclose
+	if err != nil && res != nil && res.StatusCode > 299 {
+		return &StatusError{StatusCode: res.StatusCode, Err: err}
+	}
 	return err
 }
 
-func (p *ManagerClient) retry(ctx context.Context, path, method string, in, out interface{}, b backoff.BackOffContext, ignoreStatusCode bool) (*http.Response, error) { //nolint: unparam
-	for {
-		res, err := p.doJson(ctx, path, method, in, out)
-		// do not retry on Canceled or DeadlineExceeded
-		if ctxErr := ctx.Err(); ctxErr != nil {
-			logger.Errorf(ctx, "http: context canceled")
-			return res, ctxErr
-		}
-
-		duration := b.NextBackOff()
-
-		if res != nil {
-			// Check the response code. We retry on 500-range
-			// responses to allow the server time to recover, as
-			// 500's are typically not permanent errors and may
-			// relate to outages on the server side.
-			if (ignoreStatusCode && err != nil) || res.StatusCode > 501 {
-				logger.Errorf(ctx, "url: %s server error: re-connect and re-try: %s", path, err)
-				if duration == backoff.Stop {
-					logger.Errorf(ctx, "max retry limit reached, task status won't be updated")
-					return nil, err
-				}
-				time.Sleep(duration)
-				continue
-			}
-		} else if err != nil {
-			logger.Errorf(ctx, "http: request error: %s", err)
-			if duration == backoff.Stop {
-				logger.Errorf(ctx, "max retry limit reached, task status won't be updated")
-				return nil, err
-			}
-			time.Sleep(duration)
-			continue
-		}
-		return res, err
-	}
+// SendProgress sends a progress event of a running task. It's not retried, a newer event follows.
+func (p *ManagerClient) SendProgress(ctx context.Context, delegateID, taskID string, r *TaskProgress) error {
+	path := fmt.Sprintf(taskProgressEndpoint, taskID, delegateID, p.AccountID)
+	req := r
+	_, err := p.retry(ctx, requestTaskProgress, path, "POST", req, nil) //nolint: bodyclose
+	return err
 }
 
-func (p *ManagerClient) doJson(ctx context.Context, path, method string, in, out interface{}) (*http.Response, error) {
+// doJson sends a request to the manager. A request failing because of its endpoint is sent again to the next endpoint
+// which is up, if it's idempotent or if it did not reach the manager.
+func (p *ManagerClient) doJson(ctx context.Context, path, method string, in, out interface{}, idempotent bool) (*http.Response, error) {
 	var buf = &bytes.Buffer{}
 	// marshal the input payload into json format and copy
 	// to an io.ReadCloser.
@@ -170,6 +203,58 @@ func (p *ManagerClient) doJson(ctx context.Context, path, method string, in, out
 			logger.Errorf(ctx, "could not encode input payload: %s", err)
 		}
 	}
+	headers, err := p.headers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	headers["Content-Type"] = "application/json"
+	data := buf.Bytes()
+	// The registration goes to the endpoint which is up, the other requests need the runner to be registered there
+	needsRegistration := path != fmt.Sprintf(registerEndpoint, p.AccountID) && path != fmt.Sprintf(unregisterEndpoint, p.AccountID)
+
+	tried := map[*managerEndpoint]bool{}
+	var res *http.Response
+	var body []byte
+	for {
+		e := p.endpoint(ctx)
+		tried[e] = true
+		res, body, err = nil, nil, nil
+		sent := false
+		if needsRegistration {
+			res, err = p.syncRegistration(ctx, e, headers)
+		}
+		start := time.Now()
+		if err == nil {
+			sent = true
+			res, body, err = p.client(e).Do(ctx, path, method, headers, bytes.NewBuffer(data))
+		}
+		if !p.report(ctx, e, res, err, time.Since(start)) {
+			break
+		}
+		// The manager may have processed the request, it's only sent again if that's harmless
+		if sent && !idempotent && !unprocessed(res, err) {
+			break
+		}
+		if next := p.endpoint(ctx); tried[next] {
+			break
+		}
+		logger.WithError(ctx, err).Warnf("url: %s failed on manager endpoint %s, sending it to the next endpoint", path, e.url)
+	}
+	if err != nil {
+		return res, err
+	}
+	if nil == out {
+		return res, nil
+	}
+	if jsonErr := json.Unmarshal(body, out); jsonErr != nil {
+		return res, jsonErr
+	}
+
+	return res, nil
+}
+
+// headers returns the headers authorizing a request to the manager
+func (p *ManagerClient) headers(ctx context.Context) (map[string]string, error) {
 	// the request should include the secret shared between
 	// the agent and server for authorization.
 	var err error
@@ -185,34 +270,16 @@ func (p *ManagerClient) doJson(ctx context.Context, path, method string, in, out
 	}
 	headers := make(map[string]string)
 	headers["Authorization"] = "Delegate " + token
-	headers["Content-Type"] = "application/json"
 	headers["delegateTokenHash"] = p.TokenCache.GetTokenHash()
-	res, body, err := p.Do(ctx, path, method, headers, buf)
-	if err != nil {
-		return res, err
-	}
-	if nil == out {
-		return res, nil
-	}
-	if jsonErr := json.Unmarshal(body, out); jsonErr != nil {
-		return res, jsonErr
-	}
-
-	return res, nil
+	return headers, nil
 }
 
 func (p *ManagerClient) GetLoggingToken(ctx context.Context) (*AccessTokenBean, error) {
 	path := fmt.Sprintf(stackDriverLoggingTokenEndpoint, p.AccountID)
 	credentials := &AccessTokenBeanResource{}
-	_, err := p.doJson(ctx, path, "GET", nil, credentials)
+	_, err := p.retry(ctx, requestLoggingToken, path, "GET", nil, credentials) //nolint: bodyclose
 	if err != nil {
 		logger.WithError(ctx, err).Error("Error getting stack driver logging token")
 	}
 	return credentials.AccessTokenBean, err
 }
-
-func createBackoff(ctx context.Context, maxElapsedTime time.Duration) backoff.BackOffContext {
-	exp := backoff.NewExponentialBackOff()
-	exp.MaxElapsedTime = maxElapsedTime
-	return backoff.WithContext(exp, ctx)
-}
@@ -0,0 +1,216 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package client
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/harness/runner/logger"
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy tells which failed requests to the manager are sent again, and when
+type RetryPolicy struct {
+	// Status codes of the responses which are retried. Requests which got no response are always retried
+	// if they are idempotent.
+	RetryableStatus []int
+	// Retrying stops once this much time passed since the first attempt, zero disables retries
+	MaxElapsedTime  time.Duration
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// Randomization of the wait between two attempts, 0.5 spreads it between half and one and a half times the wait
+	Jitter float64
+	// Wait for as long as the Retry-After header of the response asks, instead of the backoff
+	HonorRetryAfter bool
+	// Whether the request has the same effect when the manager gets it several times. A request which is not
+	// idempotent is only retried when the manager did not process it: the connection to the manager could not
+	// be opened, or the manager turned the request down with a 429 or 503.
+	Idempotent bool
+}
+
+// Names of the requests, in the retry logs and metrics
+const (
+	requestRegister         = "register"
+	requestUnregister       = "unregister"
+	requestHeartbeat        = "heartbeat"
+	requestRunnerEvents     = "runner_events"
+	requestExecutionPayload = "execution_payload"
+	requestTaskResponse     = "task_response"
+	requestTaskProgress     = "task_progress"
+	requestReconcile        = "daemon_set_reconcile"
+	requestAcquireDaemon    = "daemon_task_acquire"
+	requestLoggingToken     = "logging_token"
+)
+
+var defaultRetryableStatus = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// retryPolicies are the retry policies of the requests to the manager. The time given to the retries stays within
+// the timeout the callers set on the requests: heartbeats are sent again before the next one is due, the runner
+// events are polled again by the poller, and the outbox keeps sending the task responses, so they are retried
+// briefly. Task progress events are not retried, a newer event follows.
+var retryPolicies = map[string]RetryPolicy{
+	requestRegister:         {RetryableStatus: defaultRetryableStatus, MaxElapsedTime: 30 * time.Second, Jitter: 0.5, HonorRetryAfter: true, Idempotent: true},
+	requestUnregister:       {RetryableStatus: defaultRetryableStatus, MaxElapsedTime: 30 * time.Second, Jitter: 0.5, HonorRetryAfter: true, Idempotent: true},
+	requestHeartbeat:        {RetryableStatus: defaultRetryableStatus, MaxElapsedTime: 8 * time.Second, Jitter: 0.5, HonorRetryAfter: true, Idempotent: true},
+	requestRunnerEvents:     {RetryableStatus: defaultRetryableStatus, MaxElapsedTime: 10 * time.Second, Jitter: 0.5, HonorRetryAfter: true, Idempotent: true},
+	requestExecutionPayload: {RetryableStatus: defaultRetryableStatus, MaxElapsedTime: 30 * time.Second, Jitter: 0.5, HonorRetryAfter: true},
+	requestTaskResponse:     {RetryableStatus: defaultRetryableStatus, MaxElapsedTime: 30 * time.Second, Jitter: 0.5, HonorRetryAfter: true},
+	requestTaskProgress:     {},
+	requestReconcile:        {RetryableStatus: defaultRetryableStatus, MaxElapsedTime: 10 * time.Second, Jitter: 0.5, HonorRetryAfter: true, Idempotent: true},
+	requestAcquireDaemon:    {RetryableStatus: defaultRetryableStatus, MaxElapsedTime: 30 * time.Second, Jitter: 0.5, HonorRetryAfter: true, Idempotent: true},
+	requestLoggingToken:     {RetryableStatus: defaultRetryableStatus, MaxElapsedTime: 30 * time.Second, Jitter: 0.5, HonorRetryAfter: true, Idempotent: true},
+}
+
+// Decisions taken on a failed request, in the retry metrics
+const (
+	retryDecisionRetry     = "retry"
+	retryDecisionExhausted = "exhausted"
+	retryDecisionFatal     = "not_retryable"
+)
+
+// retry sends a request to the manager with the retry policy of the request. It returns the response and the error
+// of the last attempt.
+func (p *ManagerClient) retry(ctx context.Context, request, path, method string, in, out interface{}) (*http.Response, error) {
+	policy := retryPolicies[request]
+	b := policy.backoff()
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		res, err := p.doJson(ctx, path, method, in, out, policy.Idempotent)
+		if err == nil || ctx.Err() != nil {
+			return res, err
+		}
+		if !policy.retryable(res, err) {
+			if policy.MaxElapsedTime > 0 {
+				p.countRetry(request, retryDecisionFatal)
+			}
+			return res, err
+		}
+		wait := b.NextBackOff()
+		if after, ok := retryAfter(res); ok && policy.HonorRetryAfter {
+			wait = after
+		}
+		if wait == backoff.Stop || time.Since(start)+wait > policy.MaxElapsedTime {
+			p.countRetry(request, retryDecisionExhausted)
+			logger.WithError(ctx, err).Errorf("url: %s failed %d times in %s, giving up", path, attempt, time.Since(start).Round(time.Millisecond))
+			return res, errors.Wrapf(err, "request failed %d times", attempt)
+		}
+		p.countRetry(request, retryDecisionRetry)
+		logger.WithError(ctx, err).Warnf("url: %s failed (attempt %d, %s), retrying in %s", path, attempt, status(res), wait)
+		if ctxErr := sleep(ctx, wait); ctxErr != nil {
+			return res, errors.Wrapf(ctxErr, "request failed %d times, last error: %s", attempt, err)
+		}
+	}
+}
+
+func (p *ManagerClient) countRetry(request, decision string) {
+	if p.Metrics != nil {
+		p.Metrics.IncrementManagerRetryCount(request, decision, p.RunnerName)
+	}
+}
+
+func (r RetryPolicy) backoff() backoff.BackOff {
+	if r.MaxElapsedTime <= 0 {
+		return &backoff.StopBackOff{}
+	}
+	exp := backoff.NewExponentialBackOff()
+	if r.InitialInterval > 0 {
+		exp.InitialInterval = r.InitialInterval
+	}
+	if r.MaxInterval > 0 {
+		exp.MaxInterval = r.MaxInterval
+	}
+	exp.RandomizationFactor = r.Jitter
+	// The elapsed time is checked along with the Retry-After waits
+	exp.MaxElapsedTime = 0
+	exp.Reset()
+	return exp
+}
+
+// retryable tells whether the failed request can be sent again
+func (r RetryPolicy) retryable(res *http.Response, err error) bool {
+	if r.MaxElapsedTime <= 0 {
+		return false
+	}
+	if res == nil {
+		return r.Idempotent || unsent(err)
+	}
+	if !r.Idempotent && !unprocessed(res, err) {
+		return false
+	}
+	for _, code := range r.RetryableStatus {
+		if res.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// unsent tells whether the request failed before it could reach the manager
+func unsent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// unprocessed tells whether the manager did not process the failed request: it could not be sent, or the manager
+// turned it down with a 429 or 503
+func unprocessed(res *http.Response, err error) bool {
+	if res == nil {
+		return unsent(err)
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable
+}
+
+// retryAfter returns the wait asked by the Retry-After header of a response, given in seconds or as a date
+func retryAfter(res *http.Response) (time.Duration, bool) {
+	if res == nil {
+		return 0, false
+	}
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func status(res *http.Response) string {
+	if res == nil {
+		return "no response"
+	}
+	return res.Status
+}
+
+// sleep waits for d, it returns the error of ctx if ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
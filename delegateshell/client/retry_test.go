@@ -0,0 +1,96 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package client
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryable(t *testing.T) {
+	idempotent := RetryPolicy{RetryableStatus: defaultRetryableStatus, MaxElapsedTime: time.Minute, Idempotent: true}
+	nonIdempotent := RetryPolicy{RetryableStatus: defaultRetryableStatus, MaxElapsedTime: time.Minute}
+	dialErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	readErr := &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}
+
+	tests := []struct {
+		name   string
+		policy RetryPolicy
+		status int // no response if zero
+		err    error
+		want   bool
+	}{
+		{name: "retries disabled", policy: RetryPolicy{RetryableStatus: defaultRetryableStatus, Idempotent: true}, status: http.StatusServiceUnavailable},
+		{name: "idempotent, no response", policy: idempotent, err: readErr, want: true},
+		{name: "idempotent, retryable status", policy: idempotent, status: http.StatusBadGateway, want: true},
+		{name: "idempotent, request timeout", policy: idempotent, status: http.StatusRequestTimeout, want: true},
+		{name: "idempotent, client error", policy: idempotent, status: http.StatusBadRequest},
+		{name: "idempotent, not found", policy: idempotent, status: http.StatusNotFound},
+		{name: "not idempotent, not sent", policy: nonIdempotent, err: dialErr, want: true},
+		{name: "not idempotent, lost response", policy: nonIdempotent, err: readErr},
+		{name: "not idempotent, too many requests", policy: nonIdempotent, status: http.StatusTooManyRequests, want: true},
+		{name: "not idempotent, unavailable", policy: nonIdempotent, status: http.StatusServiceUnavailable, want: true},
+		{name: "not idempotent, server error", policy: nonIdempotent, status: http.StatusInternalServerError},
+		{name: "not idempotent, gateway timeout", policy: nonIdempotent, status: http.StatusGatewayTimeout},
+		{name: "status not in the policy", policy: RetryPolicy{RetryableStatus: []int{http.StatusBadGateway}, MaxElapsedTime: time.Minute, Idempotent: true}, status: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res *http.Response
+			if tt.status != 0 {
+				res = &http.Response{StatusCode: tt.status}
+			}
+			if got := tt.policy.retryable(res, tt.err); got != tt.want {
+				t.Errorf("retryable() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		noResp bool
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "no response", noResp: true},
+		{name: "no header"},
+		{name: "seconds", header: "120", want: 2 * time.Minute, wantOK: true},
+		{name: "zero seconds", header: "0", want: 0, wantOK: true},
+		{name: "negative seconds", header: "-5"},
+		{name: "past date", header: "Wed, 21 Oct 2015 07:28:00 GMT", want: 0, wantOK: true},
+		{name: "invalid", header: "soon"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res *http.Response
+			if !tt.noResp {
+				res = &http.Response{Header: http.Header{}}
+				if tt.header != "" {
+					res.Header.Set("Retry-After", tt.header)
+				}
+			}
+			got, ok := retryAfter(res)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("retryAfter(%q) = %s, %t, want %s, %t", tt.header, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRetryAfterFutureDate(t *testing.T) {
+	res := &http.Response{Header: http.Header{}}
+	res.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	got, ok := retryAfter(res)
+	if !ok || got <= 59*time.Minute || got > time.Hour {
+		t.Errorf("retryAfter() = %s, %t, want about an hour", got, ok)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/pkg/errors"
+)
+
+var (
+	// Time given to the manager to accept the stream
+	streamHandshakeTimeout = 30 * time.Second
+	// The manager pings the runner more often than this, a stream silent for longer is considered lost
+	streamIdleTimeout = 2 * time.Minute
+)
+
+// StreamRunnerEvents opens the event stream of a runner over a WebSocket or Server-Sent-Events connection
+func (p *ManagerClient) StreamRunnerEvents(ctx context.Context, runnerID, transport string) (EventStream, error) {
+	headers, err := p.headers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	path := fmt.Sprintf(runnerEventsStreamEndpoint, runnerID, p.AccountID)
+	// The stream is opened on the active endpoint, it moves to another endpoint when it reconnects
+	e := p.endpoint(ctx)
+	res, err := p.syncRegistration(ctx, e, headers)
+	if err == nil {
+		var stream EventStream
+		switch transport {
+		case delegate.TransportWebSocket:
+			stream, res, err = p.dialWebSocket(ctx, e.url+path, headers)
+		case delegate.TransportSSE:
+			stream, res, err = p.openSSE(ctx, e.url+path, headers)
+		default:
+			return nil, errors.Errorf("unknown event stream transport %q", transport)
+		}
+		if err == nil {
+			p.report(withoutLatency(ctx), e, res, nil, 0)
+			return stream, nil
+		}
+	}
+	p.report(ctx, e, res, err, 0)
+	return nil, err
+}
+
+func (p *ManagerClient) dialWebSocket(ctx context.Context, url string, headers map[string]string) (EventStream, *http.Response, error) {
+	dialer := &websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: streamHandshakeTimeout,
+	}
+	// The TLS settings of the HTTP client apply to the stream as well
+	if t, ok := p.Client.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = t.TLSClientConfig
+	}
+	header := http.Header{}
+	for k, v := range headers {
+		header.Set(k, v)
+	}
+	url = "ws" + strings.TrimPrefix(url, "http")
+	conn, res, err := dialer.DialContext(ctx, url, header)
+	if res != nil && res.Body != nil {
+		res.Body.Close()
+	}
+	if err != nil {
+		return nil, res, errors.Wrap(err, "could not open the websocket event stream")
+	}
+	s := &webSocketStream{conn: conn}
+	conn.SetPingHandler(func(data string) error {
+		_ = conn.SetReadDeadline(time.Now().Add(streamIdleTimeout))
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	return s, res, nil
+}
+
+type webSocketStream struct {
+	conn *websocket.Conn
+	// serializes the writes of the control messages
+	mu sync.Mutex
+}
+
+func (s *webSocketStream) Recv() (*StreamMessage, error) {
+	if err := s.conn.SetReadDeadline(time.Now().Add(streamIdleTimeout)); err != nil {
+		return nil, err
+	}
+	_, data, err := s.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	msg := new(StreamMessage)
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, errors.Wrap(err, "could not decode event stream message")
+	}
+	return msg, nil
+}
+
+func (s *webSocketStream) Close() error {
+	return s.conn.Close()
+}
+
+func (p *ManagerClient) openSSE(ctx context.Context, url string, headers map[string]string) (EventStream, *http.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+
+	// The handshake is bounded, the stream itself is not
+	timer := time.AfterFunc(streamHandshakeTimeout, cancel)
+	res, err := p.Client.Do(req)
+	timer.Stop()
+	if err != nil {
+		cancel()
+		return nil, nil, errors.Wrap(err, "could not open the event stream")
+	}
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		res.Body.Close()
+		cancel()
+		return nil, res, errors.Errorf("could not open the event stream: %s %s", res.Status, strings.TrimSpace(string(body)))
+	}
+	s := &sseStream{body: res.Body, reader: bufio.NewReader(res.Body), cancel: cancel}
+	// A silent stream is closed, which fails the pending read
+	s.idle = time.AfterFunc(streamIdleTimeout, cancel)
+	return s, res, nil
+}
+
+// sseStream reads the events of a Server-Sent-Events stream. The data of an event is a JSON StreamMessage,
+// the type of the message defaults to the name of the event.
+type sseStream struct {
+	body   io.ReadCloser
+	reader *bufio.Reader
+	cancel context.CancelFunc
+	idle   *time.Timer
+}
+
+func (s *sseStream) Recv() (*StreamMessage, error) {
+	var event string
+	var data []string
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		s.idle.Reset(streamIdleTimeout)
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case line == "":
+			// A blank line dispatches the event
+			if len(data) == 0 {
+				event = ""
+				continue
+			}
+			msg := new(StreamMessage)
+			if err := json.Unmarshal([]byte(strings.Join(data, "\n")), msg); err != nil {
+				return nil, errors.Wrap(err, "could not decode event stream message")
+			}
+			if msg.Type == "" {
+				msg.Type = StreamMessageType(event)
+			}
+			return msg, nil
+		case strings.HasPrefix(line, ":"):
+			// comment, sent by the manager to keep the connection alive
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+}
+
+func (s *sseStream) Close() error {
+	s.idle.Stop()
+	s.cancel()
+	return s.body.Close()
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/drone/go-task/task"
 	"github.com/harness/runner/delegateshell/daemonset/client"
@@ -14,6 +15,34 @@ type StatusCode string
 const (
 	StatusCodeSuccess StatusCode = "OK"
 	StatusCodeFailed  StatusCode = "FAILED"
+	StatusCodeAborted StatusCode = "ABORTED"
+)
+
+// ErrorCode gives the reason of a failed task response.
+type ErrorCode string
+
+// ErrorCode enumeration.
+const (
+	ErrorCodeTimeout ErrorCode = "TIMEOUT"
+)
+
+// RunnerEventType represents the kind of a runner event.
+// An empty event type means the task is ready to be executed.
+type RunnerEventType string
+
+// RunnerEventType enumeration.
+const (
+	RunnerEventTypeAbort RunnerEventType = "ABORT"
+)
+
+// StreamMessageType represents the kind of a message pushed on the event stream.
+type StreamMessageType string
+
+// StreamMessageType enumeration.
+const (
+	StreamMessageRunnerEvents StreamMessageType = "RUNNER_EVENTS"
+	StreamMessageReconcile    StreamMessageType = "DAEMON_RECONCILE"
+	StreamMessagePing         StreamMessageType = "PING"
 )
 
 // TODO: Make the structs more generic and remove Harness specific stuff
@@ -36,6 +65,35 @@ type (
 		Version           string               `json:"version,omitempty"`
 		CapacityConfig    RunnerCapacityConfig `json:"capacityConfig,omitempty"`
 		IsRunner          bool                 `json:"runner"`
+		RunningTasks      int                  `json:"runningTasks"` // number of tasks currently taken up by the runner
+		Stats             *RunnerStats         `json:"stats,omitempty"`
+	}
+
+	// RunnerStats is a snapshot of the host and of the workload of the runner, sent along with the heartbeats
+	RunnerStats struct {
+		Version       string  `json:"version"`
+		CPUPercent    float64 `json:"cpuPercent"`
+		MemoryPercent float64 `json:"memoryPercent"`
+		DiskPercent   float64 `json:"diskPercent"`
+		// number of running tasks by task type
+		RunningTasks map[string]int     `json:"runningTasksByType"`
+		DaemonSets   []DaemonSetHealth  `json:"daemonSets,omitempty"`
+		Pools        []PoolAvailability `json:"pools,omitempty"`
+		CollectedAt  int64              `json:"collectedAt"`
+	}
+
+	DaemonSetHealth struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Healthy bool   `json:"healthy"`
+	}
+
+	// PoolAvailability is the number of VMs of a pool of a VM runner, by state
+	PoolAvailability struct {
+		Name        string `json:"name"`
+		Free        int    `json:"free"`
+		Busy        int    `json:"busy"`
+		Hibernating int    `json:"hibernating"`
 	}
 
 	// Used in the java codebase :'(
@@ -52,16 +110,24 @@ type (
 	}
 
 	RunnerEvent struct {
-		AccountID  string `json:"accountId"`
-		TaskID     string `json:"taskId"`
-		RunnerType string `json:"runnerType"`
-		TaskType   string `json:"taskType"`
+		AccountID  string          `json:"accountId"`
+		TaskID     string          `json:"taskId"`
+		RunnerType string          `json:"runnerType"`
+		TaskType   string          `json:"taskType"`
+		EventType  RunnerEventType `json:"eventType,omitempty"`
 	}
 
 	RunnerEventsResponse struct {
 		RunnerEvents []*RunnerEvent `json:"delegateRunnerEvents"`
 	}
 
+	// StreamMessage is a message pushed by the manager on the event stream. Runner events carry
+	// the new tasks and the abort signals, a reconcile message asks for a daemon set reconciliation.
+	StreamMessage struct {
+		Type         StreamMessageType `json:"type"`
+		RunnerEvents []*RunnerEvent    `json:"delegateRunnerEvents,omitempty"`
+	}
+
 	TaskEvent struct {
 		AccountID string `json:"accountId"`
 		TaskID    string `json:"delegateTaskId"`
@@ -92,11 +158,22 @@ type (
 	}
 
 	TaskResponse struct {
-		ID    string     `json:"id"`
-		Data  []byte     `json:"data"`
-		Error string     `json:"error"`
-		Type  string     `json:"type"`
-		Code  StatusCode `json:"code"` // OK, FAILED
+		ID        string     `json:"id"`
+		Data      []byte     `json:"data"`
+		Error     string     `json:"error"`
+		ErrorCode ErrorCode  `json:"errorCode,omitempty"`
+		Type      string     `json:"type"`
+		Code      StatusCode `json:"code"` // OK, FAILED, ABORTED
+	}
+
+	// TaskProgress is an intermediate progress event of a running task
+	TaskProgress struct {
+		ID    string `json:"id"`
+		Phase string `json:"phase,omitempty"`
+		// Percentage of completion, -1 if it's unknown
+		Percentage int    `json:"percentage"`
+		Message    string `json:"message,omitempty"`
+		Timestamp  int64  `json:"timestamp"`
 	}
 
 	RunnerCapacityConfig struct {
@@ -107,6 +184,9 @@ type (
 
 	RunnerAcquiredTasks struct {
 		Requests []*task.Request `json:"requests"`
+		// Timeouts holds the execution timeout set by the manager for each request, in the same
+		// order as Requests. A zero value means the manager did not set a timeout.
+		Timeouts []time.Duration `json:"-"`
 	}
 
 	UnregisterRequest struct {
@@ -164,3 +244,41 @@ type (
 		AccessTokenBean *AccessTokenBean `json:"resource"`
 	}
 )
+
+// UnmarshalJSON decodes the requests and the execution timeout of each request.
+// The timeout is sent by the manager in seconds as part of the task.
+func (r *RunnerAcquiredTasks) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Requests []json.RawMessage `json:"requests"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	r.Requests = make([]*task.Request, 0, len(raw.Requests))
+	r.Timeouts = make([]time.Duration, 0, len(raw.Requests))
+	for _, b := range raw.Requests {
+		var req *task.Request
+		if err := json.Unmarshal(b, &req); err != nil {
+			return err
+		}
+		var t struct {
+			Task struct {
+				Timeout int `json:"timeout"`
+			} `json:"task"`
+		}
+		if err := json.Unmarshal(b, &t); err != nil {
+			return err
+		}
+		r.Requests = append(r.Requests, req)
+		r.Timeouts = append(r.Timeouts, time.Duration(t.Task.Timeout)*time.Second)
+	}
+	return nil
+}
+
+// Timeout returns the execution timeout set by the manager for the i-th request.
+func (r *RunnerAcquiredTasks) Timeout(i int) time.Duration {
+	if i < 0 || i >= len(r.Timeouts) {
+		return 0
+	}
+	return r.Timeouts[i]
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"github.com/google/wire"
 	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/metrics"
 )
 
 var WireSet = wire.NewSet(
@@ -11,12 +12,22 @@ var WireSet = wire.NewSet(
 
 func ProvideManagerClient(
 	config *delegate.Config,
-) Client {
-	return NewManagerClient(
-		config.GetHarnessUrl(),
+	tokens *delegate.TokenSource,
+	m metrics.Metrics,
+) *ManagerClient {
+	c := NewManagerClient(
+		config.GetHarnessUrls(),
 		config.Delegate.AccountID,
-		config.GetToken(),
+		tokens.Get(),
 		config.Server.Insecure,
 		"", // no additional certs directory for now
+		config.GetClientCertificate(),
 	)
+	c.LongPoll = config.GetPollingConfig().LongPoll
+	c.Failover = config.GetFailoverConfig()
+	c.Metrics = m
+	c.RunnerName = config.GetName()
+	// The requests in flight keep the token they were sent with, the next ones use the rotated token
+	tokens.Subscribe(c.TokenCache.SetSecret)
+	return c
 }
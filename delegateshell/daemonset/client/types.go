@@ -17,6 +17,11 @@ type (
 		DaemonSetId string
 		Type        string
 		Config      *DaemonSetOperationalConfig
+		// environment variables holding secrets, they are given to the process but are not part of the
+		// config reported to the manager
+		SecretEnvs []string
+		// dial-home token the process was started with
+		RunnerToken string
 		ServerInfo  *DaemonSetServerInfo
 		Healthy     bool
 	}
@@ -7,11 +7,15 @@ package daemonset
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/harness/runner/logger"
+	"github.com/harness/runner/utils"
 	"github.com/sirupsen/logrus"
 
 	"github.com/drone/go-task/task/downloader"
@@ -34,18 +38,34 @@ type DaemonSetManager struct {
 	driver     drivers.DaemonSetDriver
 	// the `lock` here is a wrapper for a map of locks, indexed by daemon set's type
 	// so that we can make sure operations are atomic for each daemon set type
-	lock                *KeyLock
-	accountId           string
-	managerUrl          string
-	runnerToken         string
+	lock      *KeyLock
+	accountId string
+	// endpoints of the manager in order of preference, the daemon sets fail over between them like the runner
+	managerUrls         []string
+	runnerToken         atomic.Value // string, the token is rotated while the daemon sets run
 	enableRemoteLogging bool
 	dialHomeInsecure    bool
+	// certificate the daemon sets present to the manager, if set
+	dialHomeCert *utils.ClientCertificate
 }
 
-func NewDaemonSetManager(d downloader.Downloader, isK8s bool, accountId, managerUrl, runnerToken string, enableRemoteLogging, dialHomeInsecure bool) *DaemonSetManager {
+func NewDaemonSetManager(d downloader.Downloader, isK8s bool, accountId string, managerUrls []string, runnerToken string, enableRemoteLogging, dialHomeInsecure bool, dialHomeCert *utils.ClientCertificate) *DaemonSetManager {
 	// TODO: Add suport for daemon sets in k8s runner. For this, we need to implement the `K8sServerDriver`.
-	return &DaemonSetManager{downloader: d, daemonsets: &sync.Map{}, lock: NewKeyLock(), driver: drivers.NewLocalDriver(), accountId: accountId, managerUrl: managerUrl,
-		runnerToken: runnerToken, enableRemoteLogging: enableRemoteLogging, dialHomeInsecure: dialHomeInsecure}
+	m := &DaemonSetManager{downloader: d, daemonsets: &sync.Map{}, lock: NewKeyLock(), driver: drivers.NewLocalDriver(), accountId: accountId, managerUrls: managerUrls,
+		enableRemoteLogging: enableRemoteLogging, dialHomeInsecure: dialHomeInsecure, dialHomeCert: dialHomeCert}
+	m.runnerToken.Store(runnerToken)
+	return m
+}
+
+// SetRunnerToken replaces the dial-home token of the daemon sets. The token is not part of the config of a daemon set,
+// so a rotation alone does not make it differ: a running daemon set is restarted with the new token when it's upserted
+// while it has no tasks assigned, so that no task is dropped. A daemon set respawned for any other reason gets it too.
+func (d *DaemonSetManager) SetRunnerToken(token string) {
+	d.runnerToken.Store(token)
+}
+
+func (d *DaemonSetManager) getRunnerToken() string {
+	return d.runnerToken.Load().(string)
 }
 
 // Get will return a *DaemonSet struct from the d.daemonsets synchronized map
@@ -58,6 +78,16 @@ func (d *DaemonSetManager) Get(t string) (*dsclient.DaemonSet, bool) {
 	return ds.(*dsclient.DaemonSet), true
 }
 
+// GetAll returns all the daemon sets currently existing in `d.daemonsets`
+func (d *DaemonSetManager) GetAll() []*dsclient.DaemonSet {
+	var daemonSets []*dsclient.DaemonSet
+	d.daemonsets.Range(func(key, value interface{}) bool {
+		daemonSets = append(daemonSets, value.(*dsclient.DaemonSet))
+		return true
+	})
+	return daemonSets
+}
+
 // GetAllTypes returns a set of all the daemon set types currently existing in `d.daemonsets`
 func (d *DaemonSetManager) GetAllTypes() map[string]bool {
 	m := make(map[string]bool)
@@ -77,10 +107,9 @@ func (d *DaemonSetManager) UpsertDaemonSet(ctx context.Context, dsId string, dsT
 
 	// Add env variables for dial-home support, so that
 	// the daemon server can make requests to Harness manager
-	dsConfig.Envs = append(dsConfig.Envs,
-		fmt.Sprintf("DIAL_HOME_URL=%s", d.managerUrl),
-		fmt.Sprintf("DIAL_HOME_TOKEN=%s", d.runnerToken),
-	)
+	// The endpoints of the manager are given as a comma separated list, in order of preference
+	dsConfig.Envs = append(dsConfig.Envs, fmt.Sprintf("DIAL_HOME_URL=%s", strings.Join(d.managerUrls, ",")))
+	d.setClientCertificateEnv(dsConfig)
 
 	d.setRemoteLoggingEnv(ctx, dsConfig)
 	// check if daemon set already exists in daemon set map
@@ -90,11 +119,16 @@ func (d *DaemonSetManager) UpsertDaemonSet(ctx context.Context, dsId string, dsT
 	// and return the tasks assigned to it
 	if ok && isConfigIdentical(ds.Config, dsConfig) {
 		tasks, err := d.driver.ListDaemonTasks(ctx, ds)
-		if err == nil {
+		switch {
+		case err != nil:
+			dsLogger(ctx, ds).Error("failed to list tasks, respawning this daemon set")
+		case ds.RunnerToken != d.getRunnerToken() && len(*tasks) == 0:
+			// restarting an idle daemon set drops no task
+			dsLogger(ctx, ds).Info("runner token rotated, respawning this daemon set")
+		default:
 			ds.DaemonSetId = dsId
 			return tasks, nil
 		}
-		dsLogger(ctx, ds).Error("failed to list tasks, respawning this daemon set")
 	}
 
 	ds = &dsclient.DaemonSet{DaemonSetId: dsId, Type: dsType, Config: dsConfig}
@@ -258,6 +292,10 @@ func (d *DaemonSetManager) startDaemonSet(ctx context.Context, ds *dsclient.Daem
 		d.daemonsets.Delete(oldDs.Type)
 	}
 
+	// the secrets are not part of the config, the process is given their current values
+	ds.RunnerToken = d.getRunnerToken()
+	ds.SecretEnvs = d.secretEnvs(ds.RunnerToken)
+
 	serverInfo, err := d.driver.StartDaemonSet(ctx, binpath, ds)
 	if err != nil {
 		return tasks, err
@@ -282,11 +320,11 @@ func (d *DaemonSetManager) setRemoteLoggingEnv(ctx context.Context, dsConfig *ds
 			logger.Warnln(ctx, "AccountID is not set. Cannot publish logs to remote")
 			return
 		}
-		if d.managerUrl == "" {
+		if len(d.managerUrls) == 0 {
 			logger.Println(ctx, "ManagerURL is not set. Cannot publish logs to remote")
 			return
 		}
-		if d.runnerToken == "" {
+		if d.getRunnerToken() == "" {
 			logger.Println(ctx, "Runner token is not set. Cannot publish logs to remote")
 			return
 		}
@@ -298,6 +336,43 @@ func (d *DaemonSetManager) setRemoteLoggingEnv(ctx context.Context, dsConfig *ds
 	}
 }
 
+// setClientCertificateEnv passes the client certificate of the runner on to the daemon set, for the gateways
+// requiring mutual TLS. The daemon set reads the files itself, so it picks up the rotated certificates as well.
+// The password of a PKCS#12 bundle is given apart, see secretEnvs.
+func (d *DaemonSetManager) setClientCertificateEnv(dsConfig *dsclient.DaemonSetOperationalConfig) {
+	if d.dialHomeCert == nil {
+		return
+	}
+	// The daemon set may run from another working directory
+	abs := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		if p, err := filepath.Abs(path); err == nil {
+			return p
+		}
+		return path
+	}
+	if d.dialHomeCert.CertFile != "" {
+		dsConfig.Envs = append(dsConfig.Envs,
+			fmt.Sprintf("DIAL_HOME_CLIENT_CERT_FILE=%s", abs(d.dialHomeCert.CertFile)),
+			fmt.Sprintf("DIAL_HOME_CLIENT_KEY_FILE=%s", abs(d.dialHomeCert.KeyFile)),
+		)
+		return
+	}
+	dsConfig.Envs = append(dsConfig.Envs, fmt.Sprintf("DIAL_HOME_CLIENT_PKCS12_FILE=%s", abs(d.dialHomeCert.PKCS12File)))
+}
+
+// secretEnvs returns the environment variables holding the secrets of the daemon set. They must not be reported to
+// the manager with the config, and the token is rotated without the config changing.
+func (d *DaemonSetManager) secretEnvs(runnerToken string) []string {
+	envs := []string{fmt.Sprintf("DIAL_HOME_TOKEN=%s", runnerToken)}
+	if d.dialHomeCert != nil && d.dialHomeCert.CertFile == "" {
+		envs = append(envs, fmt.Sprintf("DIAL_HOME_CLIENT_PKCS12_PASSWORD=%s", d.dialHomeCert.PKCS12Password))
+	}
+	return envs
+}
+
 // download the daemon set's executable file
 func (d *DaemonSetManager) download(ctx context.Context, ds *dsclient.DaemonSet) (string, error) {
 	if ds.Config.ExecutableConfig == nil {
@@ -7,6 +7,7 @@ package daemonset
 import (
 	"context"
 	"encoding/json"
+	"sync/atomic"
 	"time"
 
 	"github.com/harness/runner/logger"
@@ -29,6 +30,10 @@ type DaemonSetReconciler struct {
 	ctx              context.Context
 	cancelCtx        context.CancelFunc
 	doneChannel      chan bool
+	// runs a reconciliation ahead of the interval
+	trigger chan struct{}
+	// ID of the runner the daemon sets are reconciled for
+	runnerID atomic.Value
 }
 
 func NewDaemonSetReconciler(
@@ -47,11 +52,13 @@ func NewDaemonSetReconciler(
 		ctx:              ctx,
 		cancelCtx:        cancelCtx,
 		doneChannel:      make(chan bool),
+		trigger:          make(chan struct{}, 1),
 	}
 }
 
 // Start will start the daemon set reconciling job
 func (d *DaemonSetReconciler) Start(ctx context.Context, id string, interval time.Duration) error {
+	d.runnerID.Store(id)
 	// Task event poller
 	go func() {
 		timer := time.NewTimer(interval)
@@ -63,20 +70,41 @@ func (d *DaemonSetReconciler) Start(ctx context.Context, id string, interval tim
 				close(d.doneChannel)
 				logger.Info(ctx, "Stopped daemon set reconciliation job")
 				return
-			case <-timer.C:
-				taskEventsCtx, cancelFn := context.WithTimeout(d.ctx, reconcileTimeout)
-				err := d.reconcile(taskEventsCtx, id)
-				if err != nil {
-					logger.WithError(ctx, err).Errorf("daemon set reconciliation failed")
+			case <-d.trigger:
+				// The interval starts over after the triggered reconciliation
+				if !timer.Stop() {
+					<-timer.C
 				}
-				cancelFn()
+			case <-timer.C:
 			}
+			taskEventsCtx, cancelFn := context.WithTimeout(d.ctx, reconcileTimeout)
+			err := d.reconcile(taskEventsCtx, d.runnerID.Load().(string))
+			if err != nil {
+				logger.WithError(ctx, err).Errorf("daemon set reconciliation failed")
+			}
+			cancelFn()
 		}
 	}()
 	logger.Infof(ctx, "Initialized reconcile flow for daemon sets!")
 	return nil
 }
 
+// Trigger asks for a reconciliation ahead of the interval. It does not wait for the reconciliation,
+// triggers received while one is pending are merged.
+func (d *DaemonSetReconciler) Trigger() {
+	select {
+	case d.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// SetRunnerID reconciles the daemon sets for the new ID of the runner, after it registered again.
+// A reconciliation runs right away.
+func (d *DaemonSetReconciler) SetRunnerID(id string) {
+	d.runnerID.Store(id)
+	d.Trigger()
+}
+
 // Stop will stop the daemon set reconciling job
 func (d *DaemonSetReconciler) Stop(ctx context.Context) {
 	logger.Info(ctx, "Cancelling daemon set reconciliation job")
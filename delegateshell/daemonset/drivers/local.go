@@ -33,7 +33,8 @@ func NewLocalDriver() *LocalDriver {
 func (l *LocalDriver) StartDaemonSet(ctx context.Context, binpath string, ds *client.DaemonSet) (*client.DaemonSetServerInfo, error) {
 	port := l.getPort()
 
-	cmd, err := startProcess(ctx, ds.Config.Envs, binpath, port)
+	envs := append(append([]string{}, ds.Config.Envs...), ds.SecretEnvs...)
+	cmd, err := startProcess(ctx, envs, binpath, port)
 	if err != nil {
 		return nil, err
 	}
@@ -18,28 +18,36 @@ var WireSet = wire.NewSet(
 
 func ProvideDaemonSetManager(
 	config *delegate.Config,
+	tokens *delegate.TokenSource,
 	downloader downloader.Downloader,
 ) *DaemonSetManager {
-	return NewDaemonSetManager(downloader,
+	m := NewDaemonSetManager(downloader,
 		delegate.IsK8sRunner(config.GetRunnerType()),
 		config.Delegate.AccountID,
-		config.GetHarnessUrl(),
-		config.GetToken(),
+		config.GetHarnessUrls(),
+		tokens.Get(),
 		config.EnableRemoteLogging,
-		config.Server.Insecure)
+		config.Server.Insecure,
+		config.GetClientCertificate())
+	tokens.Subscribe(m.SetRunnerToken)
+	return m
 }
 
 func ProvideDaemonSetReconciler(
 	daemonSetManager *DaemonSetManager,
+	tokens *delegate.TokenSource,
 	router *task.Router,
 	managerClient client.Client,
 	metrics metrics.Metrics,
 ) *DaemonSetReconciler {
-	return NewDaemonSetReconciler(
+	r := NewDaemonSetReconciler(
 		context.Background(), // TODO: This should probably come from global context, need to verify
 		daemonSetManager,
 		router,
 		managerClient,
 		metrics,
 	)
+	// The daemon sets are upserted again right away, the idle ones are restarted with the rotated token
+	tokens.Subscribe(func(string) { r.Trigger() })
+	return r
 }
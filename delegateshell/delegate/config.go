@@ -10,11 +10,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/drone-runners/drone-runner-aws/command/config"
+	"github.com/harness/runner/utils"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/mitchellh/go-homedir"
 )
@@ -31,14 +35,25 @@ const (
 
 type RunnerType string
 
+// Transports of the runner events
+const (
+	TransportPoll      = "poll"
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+)
+
 // Config Sample config
 type Config struct {
 	Debug               bool `envconfig:"DEBUG"`
 	Trace               bool `envconfig:"TRACE"`
 	EnableRemoteLogging bool `envconfig:"ENABLE_REMOTE_LOGGING" default:"false"`
 
+	// ID of the runner, populated after a successful registration call to the manager. It changes when the runner
+	// registers again, so it's read and written through GetDelegateID and SetDelegateID.
+	delegateIDMu sync.RWMutex
+	delegateID   string
+
 	Delegate struct {
-		ID              string // This is populated after a successful registration call to the manager
 		AccountID       string `envconfig:"ACCOUNT_ID"`
 		Token           string `envconfig:"DELEGATE_TOKEN"`
 		Tags            string `envconfig:"DELEGATE_TAGS" split_words:"true"`
@@ -47,11 +62,29 @@ type Config struct {
 
 		ParallelWorkers       int `envconfig:"PARALLEL_WORKERS" default:"100"`
 		PollIntervalMilliSecs int `envconfig:"POLL_INTERVAL_MILLISECS" default:"3000"`
+		// The poll interval adapts to the manager's responses: it drops to the minimum right after
+		// events arrive, grows up to the idle maximum while there are none, and backs off up to the
+		// error maximum while the manager is failing.
+		PollMinIntervalMilliSecs      int `envconfig:"POLL_MIN_INTERVAL_MILLISECS" default:"500"`
+		PollIdleMaxIntervalMilliSecs  int `envconfig:"POLL_IDLE_MAX_INTERVAL_MILLISECS" default:"10000"`
+		PollErrorMaxIntervalMilliSecs int `envconfig:"POLL_ERROR_MAX_INTERVAL_MILLISECS" default:"60000"`
+		// If set, the manager holds the poll request open for up to this many seconds until events arrive
+		PollLongPollSecs int `envconfig:"POLL_LONG_POLL_SECS"`
+		// With the websocket or sse transport, the manager pushes the runner events over a persistent connection.
+		// The runner reconnects when the connection is lost and polls in the meantime. It also polls right after
+		// connecting and every resync period, to catch up on the events it could not take while it was full.
+		EventTransport        string `envconfig:"EVENT_TRANSPORT" default:"poll"`
+		EventStreamResyncSecs int    `envconfig:"EVENT_STREAM_RESYNC_SECS" default:"60"`
 
 		TaskServiceURL string     `envconfig:"TASK_SERVICE_URL" default:"http://localhost:3461"`
 		Type           RunnerType `envconfig:"DELEGATE_TYPE"`
 		RunnerType     RunnerType `envconfig:"RUNNER_TYPE"`
 		MaxStages      *int       `envconfig:"MAX_STAGES"`
+		// Time given to the in progress tasks to complete on shutdown, before they are cancelled. Zero waits indefinitely.
+		DrainTimeout time.Duration `envconfig:"DRAIN_TIMEOUT"`
+		// The runner registers again when the manager answers a heartbeat as if it did not know the runner, or after
+		// this many heartbeats failed in a row. Zero only registers again on the former.
+		HeartbeatFailureThreshold int `envconfig:"HEARTBEAT_FAILURE_THRESHOLD" default:"6"`
 	}
 
 	Server struct {
@@ -63,6 +96,16 @@ type Config struct {
 		Insecure          bool   `envconfig:"SERVER_INSECURE" default:"true"`                        // run in insecure mode
 	}
 
+	// Client certificate presented to the manager and to the task service, for the gateways requiring mutual TLS.
+	// It's either a PEM certificate and key pair or a PKCS#12 bundle, and it's passed on to the daemon sets for their
+	// dial-home requests. The files are read again when they change on disk.
+	ClientTLS struct {
+		CertFile       string `envconfig:"CLIENT_TLS_CERT_FILE"`
+		KeyFile        string `envconfig:"CLIENT_TLS_KEY_FILE"`
+		PKCS12File     string `envconfig:"CLIENT_TLS_PKCS12_FILE"`
+		PKCS12Password string `envconfig:"CLIENT_TLS_PKCS12_PASSWORD"`
+	}
+
 	// Config needed to be able to run VM builds on the runners
 	VM struct {
 		Database struct {
@@ -91,6 +134,113 @@ type Config struct {
 		}
 	}
 
+	// Timeouts applied to tasks for which the manager does not set one.
+	// Per task type timeouts are given as a list of type:duration pairs, e.g. "local_execute:2h,secret/vault/fetch:2m"
+	Task struct {
+		DefaultTimeout time.Duration            `envconfig:"TASK_DEFAULT_TIMEOUT"`
+		Timeouts       map[string]time.Duration `envconfig:"TASK_TIMEOUTS"`
+		// How long the runner remembers a task it acquired, so that the task never runs twice on the runner
+		LeaseTTL time.Duration `envconfig:"TASK_LEASE_TTL" default:"24h"`
+		// Run the requests of a task with several requests concurrently, on the free capacity of the runner
+		ParallelRequests bool `envconfig:"TASK_PARALLEL_REQUESTS" default:"false"`
+		// Minimum time between two progress events of a task relayed to the manager. The last event of a task
+		// is sent again at this interval while the task runs, as a liveness signal. Zero disables progress events.
+		ProgressInterval time.Duration `envconfig:"TASK_PROGRESS_INTERVAL" default:"30s"`
+	}
+
+	// Scheduling of the acquired tasks between the accounts sharing the runner. Weights and caps are given
+	// as a list of accountID:value pairs, e.g. "acc1:3,acc2:1". Accounts without a weight get a weight of 1,
+	// a max concurrency of 0 means no cap. The weights apply when the runner takes up events: when a poll
+	// returns more events than the runner has free slots, the slots go to the accounts running the fewest
+	// tasks relative to their weight. The events left out are left for other runners, or for the next poll.
+	Scheduling struct {
+		GroupByTaskType       bool           `envconfig:"SCHEDULING_GROUP_BY_TASK_TYPE" default:"false"`
+		AccountWeights        map[string]int `envconfig:"SCHEDULING_ACCOUNT_WEIGHTS"`
+		AccountMaxConcurrency map[string]int `envconfig:"SCHEDULING_ACCOUNT_MAX_CONCURRENCY"`
+		MaxConcurrency        int            `envconfig:"SCHEDULING_DEFAULT_ACCOUNT_MAX_CONCURRENCY"`
+		// Priority classes of task types, highest priority first, e.g. "control=daemonset/*;secrets=secret/*".
+		// Task types matching no class are in the default class, which comes last. Slots reserved for a class are
+		// given as a list of class:slots pairs, e.g. "control:2,secrets:4", the other classes cannot use them.
+		PriorityClasses       PriorityClasses `envconfig:"SCHEDULING_PRIORITY_CLASSES"`
+		PriorityReservedSlots map[string]int  `envconfig:"SCHEDULING_PRIORITY_RESERVED_SLOTS"`
+	}
+
+	// Rules deciding which tasks the runner takes up. Lists are comma separated and accept glob patterns,
+	// e.g. "secret/*". Deny lists take precedence over allow lists, and an empty allow list allows everything.
+	// The expression is a list of conditions on taskType, accountId and runnerType joined by && and ||,
+	// e.g. `taskType != "local_cgi" && accountId =~ "acc-*"`.
+	Filter struct {
+		AllowTaskTypes   []string `envconfig:"FILTER_ALLOW_TASK_TYPES"`
+		DenyTaskTypes    []string `envconfig:"FILTER_DENY_TASK_TYPES"`
+		AllowAccountIDs  []string `envconfig:"FILTER_ALLOW_ACCOUNT_IDS"`
+		DenyAccountIDs   []string `envconfig:"FILTER_DENY_ACCOUNT_IDS"`
+		AllowRunnerTypes []string `envconfig:"FILTER_ALLOW_RUNNER_TYPES"`
+		DenyRunnerTypes  []string `envconfig:"FILTER_DENY_RUNNER_TYPES"`
+		Expression       string   `envconfig:"FILTER_EXPRESSION"`
+	}
+
+	// Shadow mode: the runner registers with an additional tag and polls the task events to check that it can
+	// run them, but it never acquires, executes or responds to a task. Payloads can only be decoded with the
+	// standalone task server, which gives read-only access to them. The compatibility report is written to the
+	// cache location.
+	Shadow struct {
+		Enabled        bool   `envconfig:"SHADOW_MODE" default:"false"`
+		Tag            string `envconfig:"SHADOW_TAG" default:"shadow"`
+		DecodePayloads bool   `envconfig:"SHADOW_DECODE_PAYLOADS" default:"false"`
+		Endpoint       string `envconfig:"SHADOW_REPORT_ENDPOINT" default:"/shadow"`
+	}
+
+	// Standalone mode: the runner takes its tasks from an embedded task server instead of a Harness manager.
+	// Tasks are submitted to the endpoint of the runner or dropped as JSON files in the inbox directory, and
+	// their results are kept in the standalone directory, which defaults to the cache location.
+	// Whoever can submit a task can run code on the host, so the task API is not served along with the other
+	// endpoints: it has its own listener, on a loopback address or a unix socket (unix:///path/to/socket) by
+	// default. Binding it to any other address requires a token, which the clients send as a bearer token.
+	Standalone struct {
+		Enabled  bool   `envconfig:"STANDALONE_MODE" default:"false"`
+		Dir      string `envconfig:"STANDALONE_DIR"`
+		Inbox    string `envconfig:"STANDALONE_INBOX"`
+		Endpoint string `envconfig:"STANDALONE_ENDPOINT" default:"/standalone/tasks"`
+		Bind     string `envconfig:"STANDALONE_BIND" default:"127.0.0.1:3001"`
+		Token    string `envconfig:"STANDALONE_TOKEN"`
+	}
+
+	// Admission control of the tasks by task type, given as lists of taskType:value pairs, e.g. "local_init:5".
+	// A task waits up to the max wait for a free slot and a rate token, it's rejected if it can't get them or if
+	// the queue of its task type is full. The rate is in tasks per second, a zero value means no limit. The task
+	// types without a max wait get the default one, a max wait of 0 rejects the tasks right away.
+	Limits struct {
+		MaxConcurrency map[string]int           `envconfig:"LIMIT_MAX_CONCURRENCY"`
+		Rate           map[string]float64       `envconfig:"LIMIT_RATE"`
+		Burst          map[string]int           `envconfig:"LIMIT_BURST"`
+		MaxWait        map[string]time.Duration `envconfig:"LIMIT_MAX_WAIT"`
+		DefaultMaxWait time.Duration            `envconfig:"LIMIT_DEFAULT_MAX_WAIT" default:"1m"`
+		MaxQueue       map[string]int           `envconfig:"LIMIT_MAX_QUEUE"`
+	}
+
+	// Local record of the tasks executed by the runner, queried with `runner tasks` or the journal endpoint
+	Journal struct {
+		MaxAge     time.Duration `envconfig:"JOURNAL_MAX_AGE" default:"168h"`
+		MaxRecords int           `envconfig:"JOURNAL_MAX_RECORDS" default:"10000"`
+		Endpoint   string        `envconfig:"JOURNAL_ENDPOINT" default:"/tasks"`
+	}
+
+	// Failover between the endpoints of the manager, when URL lists several of them. An endpoint is down after a
+	// number of consecutive failures, or once the average latency of its requests exceeds the latency threshold
+	// (zero disables it). Requests go to the first endpoint which is up, and a down endpoint is tried again after
+	// the cooldown.
+	Failover struct {
+		FailureThreshold int           `envconfig:"MANAGER_FAILURE_THRESHOLD" default:"3"`
+		LatencyThreshold time.Duration `envconfig:"MANAGER_LATENCY_THRESHOLD"`
+		Cooldown         time.Duration `envconfig:"MANAGER_FAILOVER_COOLDOWN" default:"30s"`
+	}
+
+	// Snapshot of the host and of the workload of the runner, sent along with the heartbeats and served on the
+	// stats endpoint for debugging
+	Stats struct {
+		Endpoint string `envconfig:"STATS_ENDPOINT" default:"/stats"`
+	}
+
 	Metrics struct {
 		Provider string `envconfig:"METRICS_PROVIDER" default:"prometheus"`
 		Endpoint string `envconfig:"METRICS_ENDPOINT" default:"/metrics"`
@@ -107,8 +257,9 @@ type Config struct {
 
 	// Required
 	Token      string `envconfig:"TOKEN"`
+	TokenFile  string `envconfig:"TOKEN_FILE"` // File holding the token instead, e.g. a mounted secret. It's read again when it changes.
 	RunnerName string `envconfig:"NAME"`
-	HarnessUrl string `envconfig:"URL"`
+	HarnessUrl string `envconfig:"URL"` // Comma separated list of manager endpoints, in order of preference
 
 	// Optional
 	Selectors     string `envconfig:"TAGS"`
@@ -116,22 +267,149 @@ type Config struct {
 }
 
 type TaskContext struct {
-	DelegateTaskServiceURL string  // URL of Delegate Task Service
-	DelegateId             *string // Delegate id gets set after a successful runner registration call.
+	DelegateTaskServiceURL string        // URL of Delegate Task Service
+	DelegateID             func() string // Returns the delegate id, which is set after a successful runner registration call
 	DelegateName           string
 	SkipVerify             bool       // Skip SSL verification if the task is conducting https connection.
 	RunnerType             RunnerType // The type of the runner
 	ManagerEndpoint        string
 	AccountID              string // Account ID associated with the runner
 	Token                  string
+	ClientCertificate      *utils.ClientCertificate // Certificate presented to the task service, if set
+	Tokens                 *TokenSource             // Source of the rotated token, if set it takes precedence over Token
 
 	PoolMapperByAccount map[string]map[string]string
 }
 
+// GetToken returns the current runner token
+func (t *TaskContext) GetToken() string {
+	if t.Tokens != nil {
+		return t.Tokens.Get()
+	}
+	return t.Token
+}
+
+// GetDelegateID returns the current delegate id, empty before the runner is registered
+func (t *TaskContext) GetDelegateID() string {
+	if t.DelegateID != nil {
+		return t.DelegateID()
+	}
+	return ""
+}
+
 type CapacityConfig struct {
 	MaxStages *int
 }
 
+type PollingConfig struct {
+	Interval         time.Duration
+	MinInterval      time.Duration
+	IdleMaxInterval  time.Duration
+	ErrorMaxInterval time.Duration
+	LongPoll         time.Duration
+	Transport        string
+	Resync           time.Duration
+}
+
+type FailoverConfig struct {
+	FailureThreshold int
+	LatencyThreshold time.Duration
+	Cooldown         time.Duration
+}
+
+type SchedulingConfig struct {
+	GroupByTaskType bool
+	Weights         map[string]int
+	MaxConcurrency  map[string]int
+	// Max concurrency of the accounts which are not listed in MaxConcurrency
+	DefaultMaxConcurrency int
+	// Priority classes, highest priority first
+	Classes PriorityClasses
+}
+
+// PriorityClass is a class of task types which is served before the classes after it,
+// with worker slots reserved for it.
+type PriorityClass struct {
+	Name      string
+	TaskTypes []string
+	Reserved  int
+}
+
+type PriorityClasses []PriorityClass
+
+// Decode parses a list of classes separated by ";", each given as name=taskType,taskType.
+// Task types accept glob patterns, e.g. "control=daemonset/*;secrets=secret/*,delegate_task".
+func (pc *PriorityClasses) Decode(value string) error {
+	classes := PriorityClasses{}
+	for _, item := range strings.Split(value, ";") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		kvpair := strings.SplitN(item, "=", 2) //nolint:gomnd
+		name := strings.TrimSpace(kvpair[0])
+		if len(kvpair) != 2 || name == "" {
+			return fmt.Errorf("invalid priority class: %q", item)
+		}
+		class := PriorityClass{Name: name}
+		for _, taskType := range strings.Split(kvpair[1], ",") {
+			if taskType = strings.TrimSpace(taskType); taskType != "" {
+				class.TaskTypes = append(class.TaskTypes, taskType)
+			}
+		}
+		classes = append(classes, class)
+	}
+	*pc = classes
+	return nil
+}
+
+// WeightOf returns the fair-share weight of an account
+func (s SchedulingConfig) WeightOf(accountID string) int {
+	if w, ok := s.Weights[accountID]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// MaxConcurrencyOf returns the maximum number of tasks an account can run at the same time. Zero means no cap.
+func (s SchedulingConfig) MaxConcurrencyOf(accountID string) int {
+	if c, ok := s.MaxConcurrency[accountID]; ok {
+		return c
+	}
+	return s.DefaultMaxConcurrency
+}
+
+// LimitConfig is the admission control of a task type
+type LimitConfig struct {
+	MaxConcurrency int
+	Rate           float64
+	Burst          int
+	MaxWait        time.Duration
+	MaxQueue       int
+}
+
+type FilterConfig struct {
+	AllowTaskTypes   []string
+	DenyTaskTypes    []string
+	AllowAccountIDs  []string
+	DenyAccountIDs   []string
+	AllowRunnerTypes []string
+	DenyRunnerTypes  []string
+	Expression       string
+}
+
+type TimeoutConfig struct {
+	Default    time.Duration
+	ByTaskType map[string]time.Duration
+}
+
+// For returns the configured timeout for a task type. A zero value means no timeout.
+func (t TimeoutConfig) For(taskType string) time.Duration {
+	if timeout, ok := t.ByTaskType[taskType]; ok {
+		return timeout
+	}
+	return t.Default
+}
+
 // Iterates over all the entries and converts it to a simple type
 func (pma *PoolMapperByAccount) Convert() map[string]map[string]string {
 	m := map[string]map[string]string{}
@@ -176,13 +454,48 @@ func FromEnviron() (*Config, error) {
 			config.CacheLocation = filepath.Join(homedir, ".harness-runner")
 		}
 	}
+	if config.Standalone.Enabled {
+		// There is no manager to send the logs to
+		config.EnableRemoteLogging = false
+		if len(config.Delegate.AccountID) == 0 {
+			config.Delegate.AccountID = "standalone"
+		}
+	}
 	return &config, nil
 }
 
 func CheckInstallationConfig(config *Config) error {
+	switch config.Delegate.EventTransport {
+	case TransportPoll, TransportWebSocket, TransportSSE:
+	default:
+		return fmt.Errorf("unknown event transport %q, expected %s, %s or %s",
+			config.Delegate.EventTransport, TransportPoll, TransportWebSocket, TransportSSE)
+	}
+	if err := checkClientTLSConfig(config); err != nil {
+		return err
+	}
+	// A standalone runner does not connect to a manager
+	if config.Standalone.Enabled {
+		if len(config.GetName()) == 0 {
+			return errors.New("empty runner name")
+		}
+		if config.Standalone.Token == "" && !isLocalBind(config.Standalone.Bind) {
+			return fmt.Errorf("the standalone task API is bound to %s, which is not a loopback address or a unix socket: a token is required", config.Standalone.Bind)
+		}
+		return nil
+	}
 	if len(config.GetHarnessUrl()) == 0 {
 		return errors.New("empty URL of Harnesss Platform")
 	}
+	if config.Shadow.Enabled && config.Shadow.DecodePayloads {
+		return errors.New("shadow payload decoding is only supported with the standalone task server, the Harness manager " +
+			"gives no read-only access to the task payloads: unset SHADOW_DECODE_PAYLOADS")
+	}
+	if config.TokenFile != "" {
+		if _, err := readTokenFile(config.TokenFile); err != nil {
+			return fmt.Errorf("invalid token file: %w", err)
+		}
+	}
 	if len(config.GetToken()) == 0 {
 		return errors.New("empty Token value")
 	}
@@ -195,16 +508,65 @@ func CheckInstallationConfig(config *Config) error {
 	return nil
 }
 
+func checkClientTLSConfig(config *Config) error {
+	c := config.ClientTLS
+	switch {
+	case c.CertFile != "" && c.PKCS12File != "":
+		return errors.New("the client certificate is given both as a PEM pair and as a PKCS#12 bundle")
+	case (c.CertFile == "") != (c.KeyFile == ""):
+		return errors.New("the client certificate needs both a certificate and a key file")
+	}
+	if cert := config.GetClientCertificate(); cert != nil {
+		if _, err := cert.Load(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isLocalBind tells whether a listener address can only be reached from the host: a unix socket or a loopback address
+func isLocalBind(bind string) bool {
+	if strings.HasPrefix(bind, "unix://") {
+		return true
+	}
+	host, _, err := net.SplitHostPort(bind)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 // Upsert updates any fields in the config which are set after reading from
 // the environment.
 func (c *Config) UpsertDelegateID(delegateID string) {
-	if c.Delegate.ID == "" {
-		c.Delegate.ID = delegateID
+	c.delegateIDMu.Lock()
+	defer c.delegateIDMu.Unlock()
+	if c.delegateID == "" {
+		c.delegateID = delegateID
 	}
 }
 
+// GetDelegateID returns the ID the runner is registered with
+func (c *Config) GetDelegateID() string {
+	c.delegateIDMu.RLock()
+	defer c.delegateIDMu.RUnlock()
+	return c.delegateID
+}
+
+// SetDelegateID replaces the ID of the runner, once it registered again
+func (c *Config) SetDelegateID(delegateID string) {
+	c.delegateIDMu.Lock()
+	defer c.delegateIDMu.Unlock()
+	c.delegateID = delegateID
+}
+
 // GetTags returns the list of tags for the runner.
 // If a pool file is specified, it parses the tags from the pool file and appends them to the tags.
+// In shadow mode, the shadow tag is appended as well.
 func (c *Config) GetTags() []string {
 	tags := make([]string, 0)
 	for _, s := range strings.Split(pickNonEmpty(c.Selectors, c.Delegate.Tags), ",") {
@@ -212,15 +574,26 @@ func (c *Config) GetTags() []string {
 	}
 
 	// append tags present in the pool file
-	if c.VM.Pool.File != "" {
-		configPool, err := config.ParseFile(c.VM.Pool.File)
-		if err == nil {
-			tags = append(tags, parseTags(configPool)...)
-		}
+	tags = append(tags, c.GetPoolNames()...)
+	// A shadow runner can be told apart from the runners it observes
+	if c.Shadow.Enabled && c.Shadow.Tag != "" {
+		tags = append(tags, c.Shadow.Tag)
 	}
 	return tags
 }
 
+// GetPoolNames returns the names of the VM pools of the pool file, if one is set
+func (c *Config) GetPoolNames() []string {
+	if c.VM.Pool.File == "" {
+		return nil
+	}
+	configPool, err := config.ParseFile(c.VM.Pool.File)
+	if err != nil {
+		return nil
+	}
+	return parseTags(configPool)
+}
+
 func parseTags(pf *config.PoolFile) []string {
 	tags := []string{}
 	for i := range pf.Instances {
@@ -258,11 +631,36 @@ func isHexadecimalString(decodedToken string) bool {
 	return match
 }
 
+// GetHarnessUrl returns the primary endpoint of the manager
 func (c *Config) GetHarnessUrl() string {
-	return pickNonEmpty(c.HarnessUrl, c.Delegate.ManagerEndpoint)
+	if urls := c.GetHarnessUrls(); len(urls) > 0 {
+		return urls[0]
+	}
+	return ""
+}
+
+// GetHarnessUrls returns the endpoints of the manager in order of preference
+func (c *Config) GetHarnessUrls() []string {
+	urls := []string{}
+	for _, s := range strings.Split(pickNonEmpty(c.HarnessUrl, c.Delegate.ManagerEndpoint), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			urls = append(urls, s)
+		}
+	}
+	return urls
+}
+
+// GetClientCertificate returns the certificate presented to the servers requiring mutual TLS, nil if none is set
+func (c *Config) GetClientCertificate() *utils.ClientCertificate {
+	return utils.NewClientCertificate(c.ClientTLS.CertFile, c.ClientTLS.KeyFile, c.ClientTLS.PKCS12File, c.ClientTLS.PKCS12Password)
 }
 
+// GetToken returns the runner token, read from the token file if one is set
 func (c *Config) GetToken() string {
+	if c.TokenFile != "" {
+		token, _ := readTokenFile(c.TokenFile)
+		return token
+	}
 	secret := pickNonEmpty(c.Token, c.Delegate.Token)
 	return getBase64DecodedTokenString(secret)
 }
@@ -297,3 +695,89 @@ func (c *Config) GetRunnerType() RunnerType {
 func (c *Config) GetCapacityConfig() CapacityConfig {
 	return CapacityConfig{MaxStages: c.Delegate.MaxStages}
 }
+
+func (c *Config) GetTimeoutConfig() TimeoutConfig {
+	return TimeoutConfig{Default: c.Task.DefaultTimeout, ByTaskType: c.Task.Timeouts}
+}
+
+func (c *Config) GetPollingConfig() PollingConfig {
+	return PollingConfig{
+		Interval:         time.Duration(c.Delegate.PollIntervalMilliSecs) * time.Millisecond,
+		MinInterval:      time.Duration(c.Delegate.PollMinIntervalMilliSecs) * time.Millisecond,
+		IdleMaxInterval:  time.Duration(c.Delegate.PollIdleMaxIntervalMilliSecs) * time.Millisecond,
+		ErrorMaxInterval: time.Duration(c.Delegate.PollErrorMaxIntervalMilliSecs) * time.Millisecond,
+		LongPoll:         time.Duration(c.Delegate.PollLongPollSecs) * time.Second,
+		Transport:        c.Delegate.EventTransport,
+		Resync:           time.Duration(c.Delegate.EventStreamResyncSecs) * time.Second,
+	}
+}
+
+func (c *Config) GetFailoverConfig() FailoverConfig {
+	return FailoverConfig{
+		FailureThreshold: c.Failover.FailureThreshold,
+		LatencyThreshold: c.Failover.LatencyThreshold,
+		Cooldown:         c.Failover.Cooldown,
+	}
+}
+
+func (c *Config) GetSchedulingConfig() SchedulingConfig {
+	return SchedulingConfig{
+		GroupByTaskType:       c.Scheduling.GroupByTaskType,
+		Weights:               c.Scheduling.AccountWeights,
+		MaxConcurrency:        c.Scheduling.AccountMaxConcurrency,
+		DefaultMaxConcurrency: c.Scheduling.MaxConcurrency,
+		Classes:               c.getPriorityClasses(),
+	}
+}
+
+func (c *Config) getPriorityClasses() PriorityClasses {
+	classes := make(PriorityClasses, len(c.Scheduling.PriorityClasses))
+	for i, class := range c.Scheduling.PriorityClasses {
+		class.Reserved = c.Scheduling.PriorityReservedSlots[class.Name]
+		classes[i] = class
+	}
+	return classes
+}
+
+// GetLimitsConfig returns the admission control of the task types which have limits
+func (c *Config) GetLimitsConfig() map[string]LimitConfig {
+	limits := map[string]LimitConfig{}
+	set := func(taskType string, fn func(l *LimitConfig)) {
+		l := limits[taskType]
+		fn(&l)
+		limits[taskType] = l
+	}
+	for taskType, v := range c.Limits.MaxConcurrency {
+		set(taskType, func(l *LimitConfig) { l.MaxConcurrency = v })
+	}
+	for taskType, v := range c.Limits.Rate {
+		set(taskType, func(l *LimitConfig) { l.Rate = v })
+	}
+	for taskType, v := range c.Limits.Burst {
+		set(taskType, func(l *LimitConfig) { l.Burst = v })
+	}
+	for taskType, v := range c.Limits.MaxWait {
+		set(taskType, func(l *LimitConfig) { l.MaxWait = v })
+	}
+	for taskType, v := range c.Limits.MaxQueue {
+		set(taskType, func(l *LimitConfig) { l.MaxQueue = v })
+	}
+	for taskType := range limits {
+		if _, ok := c.Limits.MaxWait[taskType]; !ok {
+			set(taskType, func(l *LimitConfig) { l.MaxWait = c.Limits.DefaultMaxWait })
+		}
+	}
+	return limits
+}
+
+func (c *Config) GetFilterConfig() FilterConfig {
+	return FilterConfig{
+		AllowTaskTypes:   c.Filter.AllowTaskTypes,
+		DenyTaskTypes:    c.Filter.DenyTaskTypes,
+		AllowAccountIDs:  c.Filter.AllowAccountIDs,
+		DenyAccountIDs:   c.Filter.DenyAccountIDs,
+		AllowRunnerTypes: c.Filter.AllowRunnerTypes,
+		DenyRunnerTypes:  c.Filter.DenyRunnerTypes,
+		Expression:       c.Filter.Expression,
+	}
+}
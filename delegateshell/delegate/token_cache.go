@@ -7,6 +7,7 @@ package delegate
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/harness/runner/logger"
@@ -21,11 +22,13 @@ var (
 )
 
 type TokenCache struct {
-	id         string
+	id     string
+	expiry time.Duration
+	c      *cache.Cache
+
+	mu         sync.RWMutex
 	secret     string
 	secretHash string
-	expiry     time.Duration
-	c          *cache.Cache
 }
 
 // NewTokenCache creates a token cache which creates a new token
@@ -46,6 +49,8 @@ func NewTokenCache(id, secret string) *TokenCache {
 // If the token is cached, it returns from there. Otherwise
 // it creates a new token with a new expiration time.
 func (t *TokenCache) Get(ctx context.Context) (string, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	tv, found := t.c.Get(t.id)
 	if found {
 		return tv.(string), nil
@@ -61,5 +66,16 @@ func (t *TokenCache) Get(ctx context.Context) (string, error) {
 }
 
 func (t *TokenCache) GetTokenHash() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.secretHash
 }
+
+// SetSecret replaces the secret the tokens are created with, the tokens created with the previous secret are dropped
+func (t *TokenCache) SetSecret(secret string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.secret = secret
+	t.secretHash = utils.HashSHA256(secret)
+	t.c.Flush()
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package delegate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harness/runner/logger"
+)
+
+// Interval between two checks of the token file
+var tokenFileCheckInterval = 10 * time.Second
+
+// TokenSource holds the runner token. If the token is read from a file, e.g. a mounted Kubernetes secret, the file
+// is checked for changes and the subscribers are given the new token, so the token is rotated without a restart.
+type TokenSource struct {
+	file string
+
+	mu          sync.RWMutex
+	token       string
+	subscribers []func(token string)
+}
+
+func NewTokenSource(config *Config) *TokenSource {
+	return &TokenSource{file: config.TokenFile, token: config.GetToken()}
+}
+
+// Get returns the current runner token
+func (s *TokenSource) Get() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.token
+}
+
+// Subscribe registers a function called with the new token whenever the token changes
+func (s *TokenSource) Subscribe(fn func(token string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// Watch checks the token file for changes until ctx is done. It returns right away if the token is not read from
+// a file.
+func (s *TokenSource) Watch(ctx context.Context) {
+	if s.file == "" {
+		return
+	}
+	logger.Infof(ctx, "Watching the runner token file %s", s.file)
+	ticker := time.NewTicker(tokenFileCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.reload(ctx)
+		}
+	}
+}
+
+// reload reads the token file again. A file which can't be read or is empty, e.g. while the secret is being
+// updated, leaves the current token in place.
+func (s *TokenSource) reload(ctx context.Context) {
+	token, err := readTokenFile(s.file)
+	if err != nil {
+		logger.WithError(ctx, err).Warnln("could not read the runner token file, keeping the current token")
+		return
+	}
+	s.mu.Lock()
+	if token == s.token {
+		s.mu.Unlock()
+		return
+	}
+	s.token = token
+	subscribers := append([]func(string){}, s.subscribers...)
+	s.mu.Unlock()
+
+	logger.Infof(ctx, "The runner token changed in %s, rotating it", s.file)
+	for _, fn := range subscribers {
+		fn(token)
+	}
+}
+
+// readTokenFile reads the runner token from a file, which holds the token as it's copied from the Harness UI
+func readTokenFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("the runner token file %s is empty", path)
+	}
+	return getBase64DecodedTokenString(token), nil
+}
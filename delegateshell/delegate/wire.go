@@ -0,0 +1,9 @@
+package delegate
+
+import (
+	"github.com/google/wire"
+)
+
+var WireSet = wire.NewSet(
+	NewTokenSource,
+)
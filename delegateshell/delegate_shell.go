@@ -7,6 +7,9 @@ package delegateshell
 
 import (
 	"context"
+	"encoding/json"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/harness/runner/logger"
@@ -17,20 +20,38 @@ import (
 	"github.com/harness/runner/delegateshell/daemonset"
 	"github.com/harness/runner/delegateshell/delegate"
 	"github.com/harness/runner/delegateshell/heartbeat"
+	"github.com/harness/runner/delegateshell/journal"
+	"github.com/harness/runner/delegateshell/lease"
+	"github.com/harness/runner/delegateshell/outbox"
 	"github.com/harness/runner/delegateshell/poller"
+	"github.com/harness/runner/delegateshell/shadow"
+	"github.com/harness/runner/delegateshell/standalone"
+	"github.com/harness/runner/delegateshell/stats"
+	"github.com/harness/runner/utils"
 	"golang.org/x/sync/errgroup"
 )
 
+// Name of the file in the cache location describing what happened to the in progress tasks on the last shutdown
+const shutdownReportFile = "shutdown-report.json"
+
 type DelegateShell struct {
 	Info                *heartbeat.DelegateInfo
 	Config              *delegate.Config
 	ManagerClient       client.Client
 	KeepAlive           *heartbeat.KeepAlive
 	Poller              *poller.Poller
+	Outbox              *outbox.Outbox
+	Journal             *journal.Journal
+	Leases              *lease.Store
+	Shadow              *shadow.Shadow
+	Standalone          *standalone.Server
+	Stats               *stats.Collector
 	Downloader          downloader.Downloader
 	DaemonSetManager    *daemonset.DaemonSetManager
 	DaemonSetReconciler *daemonset.DaemonSetReconciler
 	Router              *task.Router
+	// guards Info, which changes when the runner registers again
+	mu sync.Mutex
 }
 
 func NewDelegateShell(
@@ -42,17 +63,40 @@ func NewDelegateShell(
 	downloader downloader.Downloader,
 	poller *poller.Poller,
 	keepAlive *heartbeat.KeepAlive,
+	outbox *outbox.Outbox,
+	journal *journal.Journal,
+	leases *lease.Store,
+	shadow *shadow.Shadow,
+	standalone *standalone.Server,
+	collector *stats.Collector,
 ) *DelegateShell {
-	return &DelegateShell{
+	// Let the manager know how loaded the runner is, so that it stops oversubscribing a saturated runner
+	keepAlive.SetLoad(poller.RunningTasks)
+	keepAlive.SetStats(collector.Snapshot)
+	// The manager can ask for a daemon set reconciliation over the event stream
+	poller.SetReconcileTrigger(daemonSetReconciler.Trigger)
+	if config.Shadow.Enabled {
+		poller.SetObserver(shadow.Observe)
+	}
+	d := &DelegateShell{
 		Config:              config,
 		KeepAlive:           keepAlive,
 		ManagerClient:       managerClient,
 		Downloader:          downloader,
 		Router:              router,
 		Poller:              poller,
+		Outbox:              outbox,
+		Journal:             journal,
+		Leases:              leases,
+		Shadow:              shadow,
+		Standalone:          standalone,
+		Stats:               collector,
 		DaemonSetManager:    daemonSetManager,
 		DaemonSetReconciler: daemonSetReconciler,
 	}
+	// The runner registers again when the manager lost its registration
+	keepAlive.SetReregister(d.reregister)
+	return d
 }
 
 func (d *DelegateShell) Register(ctx context.Context) (*heartbeat.DelegateInfo, error) {
@@ -62,24 +106,75 @@ func (d *DelegateShell) Register(ctx context.Context) (*heartbeat.DelegateInfo,
 	if err != nil {
 		return nil, err
 	}
+	d.mu.Lock()
 	d.Info = runnerInfo
+	d.mu.Unlock()
 	return runnerInfo, nil
 }
 
+// reregister registers the runner again once the manager lost its registration. Polling is paused meanwhile,
+// the tasks in progress keep running. The new runner ID is given to the config, and so to the task handlers,
+// to the poller and to the daemon set reconciler. It returns the new runner ID.
+func (d *DelegateShell) reregister(ctx context.Context) (string, error) {
+	d.Poller.Pause()
+	runnerInfo, err := d.Register(ctx)
+	if err != nil {
+		// The manager may only be unreachable, polling goes on with the current registration
+		d.Poller.Resume(d.info().ID)
+		return "", err
+	}
+	// The task context of the handlers reads the runner ID from the config
+	d.Config.SetDelegateID(runnerInfo.ID)
+	logger.UpdateContextInHooks(map[string]string{"runnerId": runnerInfo.ID})
+	d.DaemonSetReconciler.SetRunnerID(runnerInfo.ID)
+	d.Poller.Resume(runnerInfo.ID)
+	logger.Infof(ctx, "Runner registered again: %+v", *runnerInfo)
+	return runnerInfo.ID, nil
+}
+
+func (d *DelegateShell) info() *heartbeat.DelegateInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.Info
+}
+
 func (d *DelegateShell) Unregister(ctx context.Context) error {
+	info := d.info()
 	req := &client.UnregisterRequest{
-		ID:       d.Info.ID,
+		ID:       info.ID,
 		NG:       true,
 		Type:     "DOCKER",
-		HostName: d.Info.Host,
-		IP:       d.Info.IP,
+		HostName: info.Host,
+		IP:       info.IP,
 	}
 	return d.ManagerClient.Unregister(ctx, req)
 }
 
 func (d *DelegateShell) StartRunnerProcesses(ctx context.Context) error {
+	if d.Config.Shadow.Enabled {
+		return d.startShadowProcesses(ctx)
+	}
+	// The tasks of the standalone server are loaded before the poller asks for them
+	if d.Config.Standalone.Enabled {
+		if err := d.Standalone.Start(ctx); err != nil {
+			logger.WithError(ctx, err).Errorln("Error starting standalone task server")
+			return err
+		}
+	}
 	var rg errgroup.Group
 
+	rg.Go(func() error {
+		return d.startOutbox(ctx)
+	})
+
+	rg.Go(func() error {
+		return d.startJournal(ctx)
+	})
+
+	rg.Go(func() error {
+		return d.startLeases(ctx)
+	})
+
 	rg.Go(func() error {
 		return d.startDaemonSetReconcile(ctx)
 	})
@@ -94,12 +189,55 @@ func (d *DelegateShell) StartRunnerProcesses(ctx context.Context) error {
 	return rg.Wait()
 }
 
+// startShadowProcesses starts the processes of a shadow runner: it keeps polling and sending heartbeats, but it
+// never acquires or runs a task. Nothing is sent to the manager besides heartbeats, pending responses are left in the outbox.
+func (d *DelegateShell) startShadowProcesses(ctx context.Context) error {
+	var rg errgroup.Group
+
+	rg.Go(func() error {
+		return d.Shadow.Start(ctx)
+	})
+
+	rg.Go(func() error {
+		return d.startPoller(ctx)
+	})
+
+	rg.Go(func() error {
+		return d.sendHeartbeat(ctx)
+	})
+	return rg.Wait()
+}
+
 func (d *DelegateShell) sendHeartbeat(ctx context.Context) error {
 	logger.Infoln(ctx, "Started sending heartbeat to manager...")
 	d.KeepAlive.Heartbeat(ctx, d.Info.ID, d.Info.IP, d.Info.Host)
 	return nil
 }
 
+func (d *DelegateShell) startOutbox(ctx context.Context) error {
+	if err := d.Outbox.Start(ctx); err != nil {
+		logger.WithError(ctx, err).Errorln("Error starting task response outbox")
+		return err
+	}
+	return nil
+}
+
+func (d *DelegateShell) startJournal(ctx context.Context) error {
+	if err := d.Journal.Start(ctx); err != nil {
+		logger.WithError(ctx, err).Errorln("Error starting task journal")
+		return err
+	}
+	return nil
+}
+
+func (d *DelegateShell) startLeases(ctx context.Context) error {
+	if err := d.Leases.Start(ctx); err != nil {
+		logger.WithError(ctx, err).Errorln("Error starting task leases")
+		return err
+	}
+	return nil
+}
+
 func (d *DelegateShell) startDaemonSetReconcile(ctx context.Context) error {
 	if err := d.DaemonSetReconciler.Start(ctx, d.Info.ID, time.Minute*1); err != nil {
 		logger.WithError(ctx, err).Errorln("Error starting reconcile for daemon sets")
@@ -109,7 +247,7 @@ func (d *DelegateShell) startDaemonSetReconcile(ctx context.Context) error {
 }
 
 func (d *DelegateShell) startPoller(ctx context.Context) error {
-	if err := d.Poller.PollRunnerEvents(ctx, d.Config.Delegate.ParallelWorkers, d.Info.ID, d.Info.Name, time.Duration(d.Config.Delegate.PollIntervalMilliSecs)*time.Millisecond); err != nil {
+	if err := d.Poller.PollRunnerEvents(ctx, d.Config.Delegate.ParallelWorkers, d.Info.ID, d.Info.Name); err != nil {
 		logger.WithError(ctx, err).Errorln("Error when polling task events")
 		return err
 	}
@@ -117,7 +255,31 @@ func (d *DelegateShell) startPoller(ctx context.Context) error {
 }
 
 func (d *DelegateShell) Shutdown(ctx context.Context) {
+	if d.Config.Shadow.Enabled {
+		d.Poller.Shutdown(ctx, d.Config.Delegate.DrainTimeout)
+		if err := d.Shadow.Write(); err != nil {
+			logger.WithError(ctx, err).Errorln("could not write shadow report")
+		}
+		return
+	}
 	d.DaemonSetReconciler.Stop(ctx)
-	d.Poller.Shutdown(ctx)
+	report := d.Poller.Shutdown(ctx, d.Config.Delegate.DrainTimeout)
+	logger.WithFields(ctx, map[string]interface{}{
+		"drained":  len(report.Drained),
+		"aborted":  len(report.Aborted),
+		"orphaned": len(report.Orphaned),
+	}).Infoln("Drained in progress tasks")
+	if err := writeShutdownReport(filepath.Join(d.Config.CacheLocation, shutdownReportFile), report); err != nil {
+		logger.WithError(ctx, err).Errorln("could not write shutdown report")
+	}
 	d.DaemonSetManager.RemoveAllDaemonSets(ctx)
 }
+
+func writeShutdownReport(path string, report *poller.ShutdownReport) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The runner may be killed right after the drain, a partial report must never be left behind
+	return utils.WriteFileAtomic(path, b)
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/pkg/errors"
+)
+
+const (
+	fieldTaskType   = "taskType"
+	fieldAccountID  = "accountId"
+	fieldRunnerType = "runnerType"
+)
+
+var conditionRegex = regexp.MustCompile(`^\s*(\w+)\s*(==|!=|=~|!~)\s*(.*?)\s*$`)
+
+// Rules decides which tasks the runner takes up, from the filter rules in the config.
+type Rules struct {
+	allowTaskTypes   []*regexp.Regexp
+	denyTaskTypes    []*regexp.Regexp
+	allowAccountIDs  []*regexp.Regexp
+	denyAccountIDs   []*regexp.Regexp
+	allowRunnerTypes []*regexp.Regexp
+	denyRunnerTypes  []*regexp.Regexp
+	// The expression in disjunctive normal form: a task matches if all the conditions
+	// of at least one of the terms match.
+	expression [][]condition
+	source     string
+}
+
+type condition struct {
+	field   string
+	op      string
+	value   string
+	pattern *regexp.Regexp
+}
+
+// New parses the filter rules. It returns an error if the expression is malformed.
+func New(config delegate.FilterConfig) (*Rules, error) {
+	expression, err := parse(config.Expression)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid filter expression %q", config.Expression)
+	}
+	return &Rules{
+		allowTaskTypes:   compileAll(config.AllowTaskTypes),
+		denyTaskTypes:    compileAll(config.DenyTaskTypes),
+		allowAccountIDs:  compileAll(config.AllowAccountIDs),
+		denyAccountIDs:   compileAll(config.DenyAccountIDs),
+		allowRunnerTypes: compileAll(config.AllowRunnerTypes),
+		denyRunnerTypes:  compileAll(config.DenyRunnerTypes),
+		expression:       expression,
+		source:           config.Expression,
+	}, nil
+}
+
+// Allow returns nil if a task with the given attributes can run on this runner, or the reason why it can't.
+// Empty attributes are unknown, they are not checked against the allow and deny lists, except for the task type:
+// a task of unknown type is turned down as soon as any list is set.
+func (r *Rules) Allow(accountID, taskType, runnerType string) error {
+	if taskType == "" && r.restricted() {
+		return errors.New("task type is unknown")
+	}
+	if err := check("task type", taskType, r.allowTaskTypes, r.denyTaskTypes); err != nil {
+		return err
+	}
+	if err := check("account", accountID, r.allowAccountIDs, r.denyAccountIDs); err != nil {
+		return err
+	}
+	if err := check("runner type", runnerType, r.allowRunnerTypes, r.denyRunnerTypes); err != nil {
+		return err
+	}
+	if len(r.expression) == 0 {
+		return nil
+	}
+	fields := map[string]string{fieldTaskType: taskType, fieldAccountID: accountID, fieldRunnerType: runnerType}
+	for _, term := range r.expression {
+		if matchAll(term, fields) {
+			return nil
+		}
+	}
+	return fmt.Errorf("task does not match the filter expression %q", r.source)
+}
+
+// RunnerEvent is a poller filter function accepting the runner events allowed by the rules
+func (r *Rules) RunnerEvent(e *client.RunnerEvent) bool {
+	return r.Allow(e.AccountID, e.TaskType, e.RunnerType) == nil
+}
+
+// restricted tells whether any allow or deny list is set
+func (r *Rules) restricted() bool {
+	for _, patterns := range [][]*regexp.Regexp{r.allowTaskTypes, r.denyTaskTypes, r.allowAccountIDs, r.denyAccountIDs, r.allowRunnerTypes, r.denyRunnerTypes} {
+		if len(patterns) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func check(name, value string, allow, deny []*regexp.Regexp) error {
+	if value == "" {
+		return nil
+	}
+	if matchAny(value, deny) {
+		return fmt.Errorf("%s %s is denied", name, value)
+	}
+	if len(allow) > 0 && !matchAny(value, allow) {
+		return fmt.Errorf("%s %s is not allowed", name, value)
+	}
+	return nil
+}
+
+func matchAny(value string, patterns []*regexp.Regexp) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAll(term []condition, fields map[string]string) bool {
+	for _, c := range term {
+		value := fields[c.field]
+		var ok bool
+		switch c.op {
+		case "==":
+			ok = value == c.value
+		case "!=":
+			ok = value != c.value
+		case "=~":
+			ok = c.pattern.MatchString(value)
+		case "!~":
+			ok = !c.pattern.MatchString(value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Glob turns a glob pattern into a regular expression. * matches any sequence of characters,
+// including slashes, so that "secret/*" matches all the secret task types.
+func Glob(glob string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(glob)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return regexp.MustCompile("^" + expr + "$")
+}
+
+func compileAll(globs []string) []*regexp.Regexp {
+	var patterns []*regexp.Regexp
+	for _, glob := range globs {
+		patterns = append(patterns, Glob(strings.TrimSpace(glob)))
+	}
+	return patterns
+}
+
+// parse parses an expression like `taskType == "local_cgi" && accountId =~ "acc-*" || runnerType != DOCKER`.
+// && binds tighter than ||, values can optionally be quoted.
+func parse(expression string) ([][]condition, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, nil
+	}
+	var terms [][]condition
+	for _, t := range strings.Split(expression, "||") {
+		var term []condition
+		for _, c := range strings.Split(t, "&&") {
+			m := conditionRegex.FindStringSubmatch(c)
+			if m == nil {
+				return nil, fmt.Errorf("malformed condition %q", strings.TrimSpace(c))
+			}
+			field, op, value := m[1], m[2], strings.Trim(m[3], `"'`)
+			switch field {
+			case fieldTaskType, fieldAccountID, fieldRunnerType:
+			default:
+				return nil, fmt.Errorf("unknown field %q, expected one of %s, %s, %s", field, fieldTaskType, fieldAccountID, fieldRunnerType)
+			}
+			term = append(term, condition{field: field, op: op, value: value, pattern: Glob(value)})
+		}
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/harness/runner/delegateshell/delegate"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		// the conditions of each term, as field, operator and value
+		want    [][][3]string
+		wantErr bool
+	}{
+		{name: "empty", expression: ""},
+		{name: "blank", expression: "   "},
+		{
+			name:       "single condition",
+			expression: `taskType == "local_cgi"`,
+			want:       [][][3]string{{{"taskType", "==", "local_cgi"}}},
+		},
+		{
+			name:       "unquoted and single quoted values",
+			expression: `runnerType != DOCKER && accountId =~ 'acc-*'`,
+			want:       [][][3]string{{{"runnerType", "!=", "DOCKER"}, {"accountId", "=~", "acc-*"}}},
+		},
+		{
+			name:       "and binds tighter than or",
+			expression: `taskType == a && accountId == b || runnerType !~ "VM*"`,
+			want: [][][3]string{
+				{{"taskType", "==", "a"}, {"accountId", "==", "b"}},
+				{{"runnerType", "!~", "VM*"}},
+			},
+		},
+		{name: "unknown field", expression: `taskKind == a`, wantErr: true},
+		{name: "unknown operator", expression: `taskType = a`, wantErr: true},
+		{name: "missing operand", expression: `taskType == a &&`, wantErr: true},
+		{name: "empty term", expression: `taskType == a || `, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parse(tt.expression)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parse(%q) error = %v, want error %t", tt.expression, err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("parse(%q) = %d terms, want %d", tt.expression, len(got), len(tt.want))
+			}
+			for i, term := range got {
+				if len(term) != len(tt.want[i]) {
+					t.Fatalf("parse(%q) term %d = %d conditions, want %d", tt.expression, i, len(term), len(tt.want[i]))
+				}
+				for j, c := range term {
+					if got := [3]string{c.field, c.op, c.value}; got != tt.want[i][j] {
+						t.Errorf("parse(%q) term %d condition %d = %v, want %v", tt.expression, i, j, got, tt.want[i][j])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     delegate.FilterConfig
+		accountID  string
+		taskType   string
+		runnerType string
+		allowed    bool
+	}{
+		{name: "no rules", taskType: "local_init", allowed: true},
+		{
+			name:     "allowed task type glob",
+			config:   delegate.FilterConfig{AllowTaskTypes: []string{"secret/*"}},
+			taskType: "secret/vault/fetch",
+			allowed:  true,
+		},
+		{
+			name:     "task type not allowed",
+			config:   delegate.FilterConfig{AllowTaskTypes: []string{"secret/*"}},
+			taskType: "local_init",
+		},
+		{
+			name:     "deny wins over allow",
+			config:   delegate.FilterConfig{AllowTaskTypes: []string{"*"}, DenyTaskTypes: []string{"local_*"}},
+			taskType: "local_init",
+		},
+		{
+			name:      "denied account",
+			config:    delegate.FilterConfig{DenyAccountIDs: []string{"acc-?"}},
+			accountID: "acc-1",
+			taskType:  "local_init",
+		},
+		{name: "unknown task type without rules", allowed: true},
+		{
+			name:   "unknown task type with a deny list",
+			config: delegate.FilterConfig{DenyTaskTypes: []string{"local_cgi"}},
+		},
+		{
+			name:     "unknown attributes are not checked",
+			config:   delegate.FilterConfig{AllowRunnerTypes: []string{"VM"}},
+			taskType: "local_init",
+			allowed:  true,
+		},
+		{
+			name:       "expression matches the second term",
+			config:     delegate.FilterConfig{Expression: `taskType == a || runnerType =~ "VM*"`},
+			taskType:   "b",
+			runnerType: "VM_LINUX",
+			allowed:    true,
+		},
+		{
+			name:       "expression does not match",
+			config:     delegate.FilterConfig{Expression: `taskType == a && runnerType != DOCKER`},
+			taskType:   "a",
+			runnerType: "DOCKER",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := New(tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = rules.Allow(tt.accountID, tt.taskType, tt.runnerType)
+			if (err == nil) != tt.allowed {
+				t.Errorf("Allow(%q, %q, %q) = %v, want allowed %t", tt.accountID, tt.taskType, tt.runnerType, err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestNewInvalidExpression(t *testing.T) {
+	if _, err := New(delegate.FilterConfig{Expression: "taskType"}); err == nil {
+		t.Error("New() with a malformed expression succeeded, want an error")
+	}
+}
@@ -0,0 +1,16 @@
+package filter
+
+import (
+	"github.com/google/wire"
+	"github.com/harness/runner/delegateshell/delegate"
+)
+
+// WireSet is a Wire provider set that provides the filter rules.
+var WireSet = wire.NewSet(
+	ProvideRules,
+)
+
+// ProvideRules is a Wire provider function that parses the filter rules from the config.
+func ProvideRules(config *delegate.Config) (*Rules, error) {
+	return New(config.GetFilterConfig())
+}
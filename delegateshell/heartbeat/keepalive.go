@@ -7,10 +7,13 @@ package heartbeat
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/harness/runner/logger"
@@ -28,10 +31,23 @@ var (
 	hearbeatInterval  = 10 * time.Second
 	heartbeatTimeout  = 15 * time.Second
 	taskEventsTimeout = 30 * time.Second
+	// The stats are collected apart from the heartbeats, a slow collection must not hold them up
+	statsTimeout = 5 * time.Second
+	// Minimum time between two registrations sent again, while the manager keeps failing the heartbeats
+	reregisterInterval = time.Minute
 )
 
 type FilterFn func(*client.TaskEvent) bool
 
+// LoadFn returns the number of tasks currently running on the runner
+type LoadFn func() int
+
+// StatsFn returns a snapshot of the host and of the workload of the runner
+type StatsFn func(ctx context.Context) *client.RunnerStats
+
+// ReregisterFn registers the runner again once the manager lost its registration, it returns the new runner ID
+type ReregisterFn func(ctx context.Context) (string, error)
+
 type KeepAlive struct {
 	AccountID string
 	Name      string   // name of the runner
@@ -39,7 +55,14 @@ type KeepAlive struct {
 	Client    client.Client
 	Metrics   metrics.Metrics
 	Filter    FilterFn
+	Load      LoadFn
+	Stats     StatsFn
 	Capacity  delegate.CapacityConfig
+	// Number of heartbeats failing in a row after which the runner registers again, zero disables it
+	FailureThreshold int
+	reregister       ReregisterFn
+	// last snapshot taken by Stats, sent with the heartbeats
+	stats atomic.Pointer[client.RunnerStats]
 	// The Harness manager allows two task acquire calls with the same delegate ID to go through (by design).
 	// We need to make sure two different threads do not acquire the same task.
 	// This map makes sure Acquire() is called only once per task ID. The mapping is removed once the status
@@ -70,6 +93,21 @@ func (p *KeepAlive) SetFilter(filter FilterFn) {
 	p.Filter = filter
 }
 
+func (p *KeepAlive) SetLoad(load LoadFn) {
+	p.Load = load
+}
+
+// SetStats sets the function giving the snapshot of the runner sent along with the heartbeats
+func (p *KeepAlive) SetStats(stats StatsFn) {
+	p.Stats = stats
+}
+
+// SetReregister sets the function called to register the runner again when the heartbeats show that the manager
+// does not know the runner anymore
+func (p *KeepAlive) SetReregister(reregister ReregisterFn) {
+	p.reregister = reregister
+}
+
 // Register registers the runner with the server. The server generates a delegate ID
 // which is returned to the client.
 func (p *KeepAlive) Register(ctx context.Context) (*DelegateInfo, error) {
@@ -109,9 +147,14 @@ func (p *KeepAlive) register(ctx context.Context, ip, host string, capacity dele
 // Heartbeat starts a periodic thread in the background which continually pings the server
 func (p *KeepAlive) Heartbeat(ctx context.Context, id, ip, host string) {
 	req := p.getRegisterRequest(id, ip, host, nil)
+	if p.Stats != nil {
+		p.collectStats(ctx)
+	}
 	go func() {
 		msgDelayTimer := time.NewTimer(hearbeatInterval)
 		defer msgDelayTimer.Stop()
+		failures := 0
+		var lastReregister time.Time
 		for {
 			msgDelayTimer.Reset(hearbeatInterval)
 			select {
@@ -120,18 +163,82 @@ func (p *KeepAlive) Heartbeat(ctx context.Context, id, ip, host string) {
 				return
 			case <-msgDelayTimer.C:
 				req.LastHeartbeat = time.Now().UnixMilli()
+				if p.Load != nil {
+					req.RunningTasks = p.Load()
+				}
+				req.Stats = p.stats.Load()
 				heartbeatCtx, cancelFn := context.WithTimeout(ctx, heartbeatTimeout)
 				err := p.Client.Heartbeat(heartbeatCtx, req)
-				if err != nil && !errors.Is(err, context.Canceled) {
-					logger.WithError(ctx, err).Errorf("could not send heartbeat")
-					p.Metrics.IncrementHeartbeatFailureCount(req.AccountID, req.RunnerName)
-				}
 				cancelFn()
+				if err == nil {
+					failures = 0
+					continue
+				}
+				if errors.Is(err, context.Canceled) {
+					continue
+				}
+				logger.WithError(ctx, err).Errorf("could not send heartbeat")
+				p.Metrics.IncrementHeartbeatFailureCount(req.AccountID, req.RunnerName)
+				failures++
+				reason, lost := p.registrationLost(err, failures)
+				if !lost || p.reregister == nil || time.Since(lastReregister) < reregisterInterval {
+					continue
+				}
+				logger.WithError(ctx, err).Warnf("the manager lost the registration of runner %s (%s), registering again", req.ID, reason)
+				p.Metrics.IncrementReregistrationCount(req.AccountID, reason, req.RunnerName)
+				lastReregister = time.Now()
+				failures = 0
+				newID, err := p.reregister(ctx)
+				if err != nil {
+					logger.WithError(ctx, err).Errorf("could not register runner %s again", req.ID)
+					continue
+				}
+				req.ID = newID
 			}
 		}
 	}()
 }
 
+// collectStats takes a snapshot of the runner in the background, right away then at every heartbeat interval.
+// The heartbeats send the last snapshot taken.
+func (p *KeepAlive) collectStats(ctx context.Context) {
+	collect := func() {
+		statsCtx, cancelFn := context.WithTimeout(ctx, statsTimeout)
+		defer cancelFn()
+		p.stats.Store(p.Stats(statsCtx))
+	}
+	go func() {
+		collect()
+		ticker := time.NewTicker(hearbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				collect()
+			}
+		}
+	}()
+}
+
+// registrationLost tells whether the failed heartbeats show that the manager does not know the runner anymore:
+// the manager turns the heartbeat down as unauthorized or not found, or the heartbeats keep failing.
+// It returns the reason, used in the metrics.
+func (p *KeepAlive) registrationLost(err error, failures int) (string, bool) {
+	var statusErr *client.StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+			return fmt.Sprintf("status_%d", statusErr.StatusCode), true
+		}
+	}
+	if p.FailureThreshold > 0 && failures >= p.FailureThreshold {
+		return "consecutive_failures", true
+	}
+	return "", false
+}
+
 func (p *KeepAlive) getRegisterRequest(id, ip, host string, capacity *delegate.CapacityConfig) *client.RegisterRequest {
 	req := &client.RegisterRequest{
 		AccountID:     p.AccountID,
@@ -17,7 +17,7 @@ func ProvideKeepAlive(
 	managerClient client.Client,
 	metrics metrics.Metrics,
 ) *KeepAlive {
-	return New(
+	k := New(
 		config.Delegate.AccountID,
 		config.GetName(),
 		config.GetTags(),
@@ -25,4 +25,6 @@ func ProvideKeepAlive(
 		managerClient,
 		metrics,
 	)
+	k.FailureThreshold = config.Delegate.HeartbeatFailureThreshold
+	return k
 }
@@ -0,0 +1,87 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package journal
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Handle registers the journal query endpoints on the default mux:
+// GET <endpoint> lists the records, filtered by the status, type, account, since and limit query parameters,
+// and GET <endpoint>/<task id> returns the record of a task.
+func (j *Journal) Handle(endpoint string) {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	http.HandleFunc(endpoint, j.handleList)
+	http.HandleFunc(endpoint+"/", func(w http.ResponseWriter, r *http.Request) {
+		taskID := strings.TrimPrefix(r.URL.Path, endpoint+"/")
+		if taskID == "" {
+			j.handleList(w, r)
+			return
+		}
+		j.handleGet(w, r, taskID)
+	})
+}
+
+func (j *Journal) handleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	f := Filter{
+		Status:    q.Get("status"),
+		TaskType:  q.Get("type"),
+		AccountID: q.Get("account"),
+	}
+	if v := q.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "invalid since, expected an RFC3339 time", http.StatusBadRequest)
+			return
+		}
+		f.Since = since
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		f.Limit = limit
+	}
+	records, err := j.List(f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, records)
+}
+
+func (j *Journal) handleGet(w http.ResponseWriter, r *http.Request, taskID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	record, err := j.Get(taskID)
+	if err == ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, record)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,252 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/logger"
+	"github.com/harness/runner/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	StatusRunning = "RUNNING"
+
+	fileExt = ".json"
+)
+
+var (
+	// ErrNotFound is returned when the journal has no record of a task
+	ErrNotFound = errors.New("task not found in the journal")
+
+	// Time period between two runs of the retention
+	pruneInterval = 1 * time.Hour
+
+	// Severity of the outcomes of the requests, a task is recorded with the worst outcome of its requests
+	severity = map[string]int{
+		string(client.StatusCodeSuccess): 1,
+		string(client.StatusCodeFailed):  2,
+		string(client.StatusCodeAborted): 3,
+	}
+)
+
+// Record describes a task executed by the runner
+type Record struct {
+	TaskID       string     `json:"taskId"`
+	TaskType     string     `json:"taskType"`
+	AccountID    string     `json:"accountId"`
+	StartedAt    time.Time  `json:"startedAt"`
+	EndedAt      *time.Time `json:"endedAt,omitempty"`
+	Status       string     `json:"status"`
+	Error        string     `json:"error,omitempty"`
+	ResponseSize int        `json:"responseSize"`
+}
+
+// Filter selects the records returned by List. Empty fields match all records.
+type Filter struct {
+	Status    string
+	TaskType  string
+	AccountID string
+	Since     time.Time
+	Limit     int
+}
+
+func (f *Filter) match(r *Record) bool {
+	return (f.Status == "" || f.Status == r.Status) &&
+		(f.TaskType == "" || f.TaskType == r.TaskType) &&
+		(f.AccountID == "" || f.AccountID == r.AccountID) &&
+		(f.Since.IsZero() || !r.StartedAt.Before(f.Since))
+}
+
+// Journal records the tasks executed by the runner on disk, one file per task, so that
+// it can be queried after the fact. Records are kept for maxAge, up to maxRecords.
+type Journal struct {
+	dir        string
+	maxAge     time.Duration
+	maxRecords int
+	mu         sync.Mutex
+}
+
+func New(dir string, maxAge time.Duration, maxRecords int) *Journal {
+	return &Journal{
+		dir:        dir,
+		maxAge:     maxAge,
+		maxRecords: maxRecords,
+	}
+}
+
+// FromConfig returns the journal kept under the cache location of the runner
+func FromConfig(config *delegate.Config) *Journal {
+	return New(filepath.Join(config.CacheLocation, "journal"), config.Journal.MaxAge, config.Journal.MaxRecords)
+}
+
+// Begin records a task which was acquired by the runner
+func (j *Journal) Begin(taskID, taskType, accountID string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.write(&Record{
+		TaskID:    taskID,
+		TaskType:  taskType,
+		AccountID: accountID,
+		StartedAt: time.Now(),
+		Status:    StatusRunning,
+	})
+}
+
+// Finish records the outcome of a task. A task with several requests is finished once per request,
+// the worst status and the first error are kept, and the response sizes add up.
+func (j *Journal) Finish(taskID, status, errMsg string, responseSize int) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	r, err := j.read(j.path(taskID))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	r.EndedAt = &now
+	if severity[status] >= severity[r.Status] {
+		r.Status = status
+	}
+	if r.Error == "" {
+		r.Error = errMsg
+	}
+	r.ResponseSize += responseSize
+	return j.write(r)
+}
+
+// Get returns the record of a task
+func (j *Journal) Get(taskID string) (*Record, error) {
+	r, err := j.read(j.path(taskID))
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil, ErrNotFound
+	}
+	return r, err
+}
+
+// List returns the records matching the filter, most recent first
+func (j *Journal) List(f Filter) ([]*Record, error) {
+	records, err := j.all()
+	if err != nil {
+		return nil, err
+	}
+	matched := []*Record{}
+	for _, r := range records {
+		if !f.match(r) {
+			continue
+		}
+		matched = append(matched, r)
+		if f.Limit > 0 && len(matched) == f.Limit {
+			break
+		}
+	}
+	return matched, nil
+}
+
+// Start creates the journal directory and applies the retention, right away and then periodically.
+func (j *Journal) Start(ctx context.Context) error {
+	if err := os.MkdirAll(j.dir, 0o700); err != nil {
+		return errors.Wrap(err, "could not create task journal directory")
+	}
+	go func() {
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Infoln(ctx, "context canceled, stopping task journal retention")
+				return
+			case <-timer.C:
+				if err := j.prune(); err != nil {
+					logger.WithError(ctx, err).Errorln("could not apply the task journal retention")
+				}
+				timer.Reset(pruneInterval)
+			}
+		}
+	}()
+	logger.Infof(ctx, "Initialized task journal at %s", j.dir)
+	return nil
+}
+
+// prune removes the records older than maxAge, and the oldest records beyond maxRecords
+func (j *Journal) prune() error {
+	records, err := j.all()
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, r := range records {
+		if (j.maxAge > 0 && time.Since(r.StartedAt) > j.maxAge) || (j.maxRecords > 0 && i >= j.maxRecords) {
+			if err := os.Remove(j.path(r.TaskID)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// all returns all the records, most recent first
+func (j *Journal) all() ([]*Record, error) {
+	files, err := os.ReadDir(j.dir)
+	if os.IsNotExist(err) {
+		return []*Record{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read task journal")
+	}
+	records := []*Record{}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), fileExt) {
+			continue
+		}
+		r, err := j.read(filepath.Join(j.dir, f.Name()))
+		if err != nil {
+			// The file may have been pruned in the meantime
+			continue
+		}
+		records = append(records, r)
+	}
+	sort.Slice(records, func(a, b int) bool {
+		return records[a].StartedAt.After(records[b].StartedAt)
+	})
+	return records, nil
+}
+
+func (j *Journal) read(path string) (*Record, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read task record")
+	}
+	r := new(Record)
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, errors.Wrap(err, "could not decode task record")
+	}
+	return r, nil
+}
+
+// write persists the record atomically, so that readers never see a partial file
+func (j *Journal) write(r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(j.path(r.TaskID), b)
+}
+
+func (j *Journal) path(taskID string) string {
+	return filepath.Join(j.dir, url.PathEscape(taskID)+fileExt)
+}
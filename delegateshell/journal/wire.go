@@ -0,0 +1,16 @@
+package journal
+
+import (
+	"github.com/google/wire"
+	"github.com/harness/runner/delegateshell/delegate"
+)
+
+// WireSet is a Wire provider set that provides a Journal.
+var WireSet = wire.NewSet(
+	ProvideJournal,
+)
+
+// ProvideJournal is a Wire provider function that creates a Journal.
+func ProvideJournal(config *delegate.Config) *Journal {
+	return FromConfig(config)
+}
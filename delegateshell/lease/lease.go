@@ -0,0 +1,185 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package lease
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harness/runner/logger"
+	"github.com/harness/runner/utils"
+	"github.com/pkg/errors"
+)
+
+// State is the progress of a task on the runner.
+type State string
+
+// State enumeration.
+const (
+	// The runner is acquiring the task payload, the task did not start yet
+	StateAcquired State = "ACQUIRED"
+	// The task started, it must not be executed again
+	StateRunning State = "RUNNING"
+	// The task response is persisted in the outbox
+	StateResponded State = "RESPONDED"
+)
+
+const fileExt = ".json"
+
+// Time period between two removals of the expired leases
+var pruneInterval = 1 * time.Hour
+
+// Lease records the progress of a task acquired by the runner
+type Lease struct {
+	TaskID     string    `json:"taskId"`
+	State      State     `json:"state"`
+	AcquiredAt time.Time `json:"acquiredAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// Store keeps the leases of the tasks acquired by the runner on disk, so that a task is never
+// executed twice on the runner, even across restarts. Leases expire after ttl, by then the
+// manager has given up on the task.
+type Store struct {
+	dir string
+	ttl time.Duration
+	mu  sync.Mutex
+}
+
+func New(dir string, ttl time.Duration) *Store {
+	return &Store{
+		dir: dir,
+		ttl: ttl,
+	}
+}
+
+// Get returns the lease of a task, or nil if the task has no lease or its lease expired
+func (s *Store) Get(taskID string) (*Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, err := s.read(s.path(taskID))
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if l.expired() {
+		return nil, nil
+	}
+	return l, nil
+}
+
+// Set records the state of a task, and extends its lease
+func (s *Store) Set(taskID string, state State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	l, err := s.read(s.path(taskID))
+	if err != nil || l.expired() {
+		l = &Lease{TaskID: taskID, AcquiredAt: now}
+	}
+	l.State = state
+	l.UpdatedAt = now
+	l.ExpiresAt = now.Add(s.ttl)
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.path(taskID), b)
+}
+
+// Start reconciles the leases left over from a previous run, then removes the expired leases periodically.
+// Tasks which were running when the runner stopped are reported as failed if the manager sends them again.
+func (s *Store) Start(ctx context.Context) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return errors.Wrap(err, "could not create task lease directory")
+	}
+	leases, err := s.prune()
+	if err != nil {
+		return errors.Wrap(err, "could not reconcile task leases")
+	}
+	var interrupted []string
+	for _, l := range leases {
+		if l.State == StateRunning {
+			interrupted = append(interrupted, l.TaskID)
+		}
+	}
+	if len(interrupted) > 0 {
+		logger.WithField(ctx, "tasks", interrupted).Warnln("Tasks were interrupted by the last runner stop, they will not run again")
+	}
+	go func() {
+		timer := time.NewTimer(pruneInterval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Infoln(ctx, "context canceled, stopping task lease expiry")
+				return
+			case <-timer.C:
+				if _, err := s.prune(); err != nil {
+					logger.WithError(ctx, err).Errorln("could not remove expired task leases")
+				}
+				timer.Reset(pruneInterval)
+			}
+		}
+	}()
+	logger.Infof(ctx, "Initialized task leases at %s with %d leases", s.dir, len(leases))
+	return nil
+}
+
+// prune removes the expired leases and returns the others
+func (s *Store) prune() ([]*Lease, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var leases []*Lease
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), fileExt) {
+			continue
+		}
+		path := filepath.Join(s.dir, f.Name())
+		l, err := s.read(path)
+		if err != nil || l.expired() {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			continue
+		}
+		leases = append(leases, l)
+	}
+	return leases, nil
+}
+
+func (s *Store) read(path string) (*Lease, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read task lease")
+	}
+	l := new(Lease)
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, errors.Wrap(err, "could not decode task lease")
+	}
+	return l, nil
+}
+
+func (s *Store) path(taskID string) string {
+	return filepath.Join(s.dir, url.PathEscape(taskID)+fileExt)
+}
+
+func (l *Lease) expired() bool {
+	return time.Now().After(l.ExpiresAt)
+}
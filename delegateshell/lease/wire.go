@@ -0,0 +1,18 @@
+package lease
+
+import (
+	"path/filepath"
+
+	"github.com/google/wire"
+	"github.com/harness/runner/delegateshell/delegate"
+)
+
+// WireSet is a Wire provider set that provides a lease Store.
+var WireSet = wire.NewSet(
+	ProvideStore,
+)
+
+// ProvideStore is a Wire provider function that creates a lease Store.
+func ProvideStore(config *delegate.Config) *Store {
+	return New(filepath.Join(config.CacheLocation, "leases"), config.Task.LeaseTTL)
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package mockmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/harness/runner/delegateshell/client"
+)
+
+// handleAdmin registers the endpoints driving the manager from outside the process, e.g. from a CI job:
+//
+//	POST   /mock/tasks                 enqueues a task
+//	GET    /mock/tasks                 lists the tasks with their responses
+//	GET    /mock/tasks/{id}            returns a task with its responses
+//	POST   /mock/tasks/{id}/abort      aborts a task
+//	GET    /mock/tasks/{id}/responses  waits for the responses of a task, for up to the wait query parameter
+//	GET    /mock/faults                lists the active faults
+//	POST   /mock/faults                injects a fault
+//	DELETE /mock/faults                clears the faults
+//	POST   /mock/daemon-sets           sets the daemon sets returned by the reconcile endpoint
+//	POST   /mock/reconcile             asks the runners for a reconciliation over their event streams
+//	POST   /mock/streams/drop          closes the event streams of the runners
+//	POST   /mock/scenario              runs a scenario, it returns once the scenario completes
+//	GET    /mock/state                 returns a snapshot of the manager
+//	GET    /mock/calls                 lists the requests received from the runners
+func (m *Manager) handleAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("POST /mock/tasks", func(w http.ResponseWriter, r *http.Request) {
+		t := new(Task)
+		if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody(err.Error()))
+			return
+		}
+		id, err := m.Enqueue(t)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody(err.Error()))
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+	})
+	mux.HandleFunc("GET /mock/tasks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.Tasks())
+	})
+	mux.HandleFunc("GET /mock/tasks/{id}", func(w http.ResponseWriter, r *http.Request) {
+		t, err := m.Task(r.PathValue("id"))
+		if err != nil {
+			writeJSON(w, http.StatusNotFound, errorBody(err.Error()))
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+	})
+	mux.HandleFunc("POST /mock/tasks/{id}/abort", func(w http.ResponseWriter, r *http.Request) {
+		if err := m.Abort(r.PathValue("id")); err != nil {
+			writeJSON(w, http.StatusNotFound, errorBody(err.Error()))
+			return
+		}
+		writeJSON(w, http.StatusOK, struct{}{})
+	})
+	mux.HandleFunc("GET /mock/tasks/{id}/responses", func(w http.ResponseWriter, r *http.Request) {
+		wait := time.Duration(0)
+		if v := r.URL.Query().Get("wait"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, errorBody("invalid wait, expected a duration"))
+				return
+			}
+			wait = d
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), wait)
+		defer cancel()
+		responses, err := m.WaitForResponses(ctx, r.PathValue("id"))
+		switch {
+		case err == ErrTaskNotFound:
+			writeJSON(w, http.StatusNotFound, errorBody(err.Error()))
+		case err != nil:
+			writeJSON(w, http.StatusRequestTimeout, errorBody(err.Error()))
+		default:
+			writeJSON(w, http.StatusOK, responses)
+		}
+	})
+	mux.HandleFunc("GET /mock/faults", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.Faults())
+	})
+	mux.HandleFunc("POST /mock/faults", func(w http.ResponseWriter, r *http.Request) {
+		f := new(Fault)
+		if err := json.NewDecoder(r.Body).Decode(f); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody(err.Error()))
+			return
+		}
+		m.InjectFault(f)
+		writeJSON(w, http.StatusCreated, f)
+	})
+	mux.HandleFunc("DELETE /mock/faults", func(w http.ResponseWriter, r *http.Request) {
+		m.ClearFaults()
+		writeJSON(w, http.StatusOK, struct{}{})
+	})
+	mux.HandleFunc("POST /mock/daemon-sets", func(w http.ResponseWriter, r *http.Request) {
+		var daemonSets []client.DaemonSetServerInfo
+		if err := json.NewDecoder(r.Body).Decode(&daemonSets); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody(err.Error()))
+			return
+		}
+		m.SetDaemonSets(daemonSets)
+		writeJSON(w, http.StatusOK, struct{}{})
+	})
+	mux.HandleFunc("POST /mock/reconcile", func(w http.ResponseWriter, r *http.Request) {
+		m.TriggerReconcile()
+		writeJSON(w, http.StatusOK, struct{}{})
+	})
+	mux.HandleFunc("POST /mock/streams/drop", func(w http.ResponseWriter, r *http.Request) {
+		m.DropStreams()
+		writeJSON(w, http.StatusOK, struct{}{})
+	})
+	mux.HandleFunc("POST /mock/scenario", func(w http.ResponseWriter, r *http.Request) {
+		s := new(Scenario)
+		if err := json.NewDecoder(r.Body).Decode(s); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorBody(err.Error()))
+			return
+		}
+		if err := m.Run(r.Context(), s); err != nil {
+			writeJSON(w, http.StatusExpectationFailed, errorBody(err.Error()))
+			return
+		}
+		writeJSON(w, http.StatusOK, struct{}{})
+	})
+	mux.HandleFunc("GET /mock/state", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.Snapshot())
+	})
+	mux.HandleFunc("GET /mock/calls", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, m.Calls())
+	})
+}
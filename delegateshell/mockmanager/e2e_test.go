@@ -0,0 +1,194 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package mockmanager_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drone/go-task/task"
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/delegateshell/heartbeat"
+	"github.com/harness/runner/delegateshell/journal"
+	"github.com/harness/runner/delegateshell/lease"
+	"github.com/harness/runner/delegateshell/mockmanager"
+	"github.com/harness/runner/delegateshell/outbox"
+	"github.com/harness/runner/delegateshell/poller"
+	"github.com/harness/runner/metrics"
+	"github.com/harness/runner/metrics/providers/prometheus"
+)
+
+const (
+	accountID  = "e2e-account"
+	runnerName = "e2e-runner"
+	// The token is a hex encoded secret
+	runnerToken = "0123456789abcdef0123456789abcdef"
+
+	taskTypeEcho  = "e2e_echo"
+	taskTypeBlock = "e2e_block"
+)
+
+// TestRunnerEndToEnd runs the manager client, the keep alive and the poller of a runner against the mock manager:
+// tasks are acquired and answered, a failed response is sent again and a running task is aborted.
+func TestRunnerEndToEnd(t *testing.T) {
+	if testing.Short() {
+		t.Skip("the runner waits for its first heartbeat interval")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	m := mockmanager.New(accountID)
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	runnerMetrics := prometheus.NewPrometheusMetrics()
+	managerClient := client.NewManagerClient([]string{server.URL}, accountID, runnerToken, false, "", nil)
+	managerClient.Metrics = runnerMetrics
+	managerClient.RunnerName = runnerName
+
+	keepAlive := heartbeat.New(accountID, runnerName, []string{"e2e"}, delegate.CapacityConfig{}, managerClient, runnerMetrics)
+	info, err := keepAlive.Register(ctx)
+	if err != nil {
+		t.Fatalf("could not register the runner: %s", err)
+	}
+	if _, ok := m.Runners()[info.ID]; !ok {
+		t.Fatalf("runner %s is not registered with the manager", info.ID)
+	}
+	keepAlive.Heartbeat(ctx, info.ID, info.IP, info.Host)
+
+	p := newPoller(ctx, t, managerClient, runnerMetrics, info.ID)
+	go p.PollRunnerEvents(ctx, 2, info.ID, runnerName) //nolint:errcheck
+
+	t.Run("response", func(t *testing.T) {
+		id := enqueue(t, m, taskTypeEcho, []byte("hello"))
+		responses := waitForResponses(ctx, t, m, id)
+		if len(responses) != 1 {
+			t.Fatalf("got %d responses, want 1", len(responses))
+		}
+		if got := responses[0]; got.Code != client.StatusCodeSuccess || string(got.Data) != "hello" {
+			t.Errorf("got response %s %q, want %s %q", got.Code, got.Data, client.StatusCodeSuccess, "hello")
+		}
+		if task, _ := m.Task(id); task.AcquiredBy != info.ID {
+			t.Errorf("task acquired by %q, want %q", task.AcquiredBy, info.ID)
+		}
+	})
+
+	t.Run("response after a server error", func(t *testing.T) {
+		m.InjectFault(&mockmanager.Fault{Endpoint: mockmanager.EndpointTaskResponse, Status: http.StatusInternalServerError, Times: 1})
+		id := enqueue(t, m, taskTypeEcho, []byte("again"))
+		responses := waitForResponses(ctx, t, m, id)
+		if len(responses) != 1 || responses[0].Code != client.StatusCodeSuccess {
+			t.Fatalf("got responses %+v, want a single successful response", responses)
+		}
+		if n := countCalls(m, mockmanager.EndpointTaskResponse, http.StatusInternalServerError); n != 1 {
+			t.Errorf("got %d failed task responses, want 1", n)
+		}
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		id := enqueue(t, m, taskTypeBlock, nil)
+		waitFor(ctx, t, "the task to be acquired", func() bool {
+			task, err := m.Task(id)
+			return err == nil && task.State == mockmanager.TaskAcquired
+		})
+		if err := m.Abort(id); err != nil {
+			t.Fatal(err)
+		}
+		responses := waitForResponses(ctx, t, m, id)
+		if len(responses) != 1 || responses[0].Code != client.StatusCodeAborted {
+			t.Fatalf("got responses %+v, want a single aborted response", responses)
+		}
+	})
+
+	t.Run("heartbeat", func(t *testing.T) {
+		waitFor(ctx, t, "a heartbeat", func() bool {
+			return len(m.Heartbeats()) > 0
+		})
+		if got := m.Heartbeats()[0]; got.ID != info.ID || got.RunnerName != runnerName {
+			t.Errorf("got heartbeat of runner %s %s, want %s %s", got.ID, got.RunnerName, info.ID, runnerName)
+		}
+	})
+}
+
+// newPoller returns a poller polling the manager often, with a handler echoing the data of its task and a handler
+// blocking until its task is cancelled
+func newPoller(ctx context.Context, t *testing.T, c client.Client, m metrics.Metrics, runnerID string) *poller.Poller {
+	t.Helper()
+	router := task.NewRouter()
+	router.RegisterFunc(taskTypeEcho, func(ctx context.Context, req *task.Request) task.Response {
+		return task.Respond(string(req.Task.Data))
+	})
+	router.RegisterFunc(taskTypeBlock, func(ctx context.Context, req *task.Request) task.Response {
+		<-ctx.Done()
+		return task.Error(ctx.Err())
+	})
+
+	dir := t.TempDir()
+	o := outbox.New(filepath.Join(dir, "outbox"), c, func() string { return runnerID })
+	j := journal.New(filepath.Join(dir, "journal"), time.Hour, 100)
+	leases := lease.New(filepath.Join(dir, "leases"), time.Hour)
+	for _, start := range []func(context.Context) error{o.Start, j.Start, leases.Start} {
+		if err := start(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	polling := delegate.PollingConfig{Interval: 50 * time.Millisecond}
+	return poller.New(c, o, j, leases, router, m, false, delegate.TimeoutConfig{}, delegate.CapacityConfig{}, polling, delegate.SchedulingConfig{})
+}
+
+func enqueue(t *testing.T, m *mockmanager.Manager, taskType string, data []byte) string {
+	t.Helper()
+	request, err := json.Marshal(&task.Request{Task: &task.Task{Type: taskType, Data: data}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := m.Enqueue(&mockmanager.Task{Type: taskType, Requests: []json.RawMessage{request}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func waitForResponses(ctx context.Context, t *testing.T, m *mockmanager.Manager, taskID string) []*client.TaskResponse {
+	t.Helper()
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Second)
+	defer cancel()
+	responses, err := m.WaitForResponses(waitCtx, taskID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return responses
+}
+
+// waitFor checks the condition until it holds, it fails the test if it does not hold in time
+func waitFor(ctx context.Context, t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for !condition() {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for %s", what)
+		case <-ticker.C:
+		}
+	}
+}
+
+func countCalls(m *mockmanager.Manager, endpoint string, status int) int {
+	n := 0
+	for _, c := range m.Calls() {
+		if c.Endpoint == endpoint && c.Status == status {
+			n++
+		}
+	}
+	return n
+}
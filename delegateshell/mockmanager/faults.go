@@ -0,0 +1,103 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package mockmanager
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Fault alters the responses of an endpoint: the response is delayed by the latency, then
+// replaced by the status code, if set. An empty endpoint matches all the endpoints.
+type Fault struct {
+	Endpoint string        `json:"endpoint,omitempty"`
+	Status   int           `json:"status,omitempty"`
+	Latency  time.Duration `json:"latency,omitempty"`
+	// Number of requests the fault applies to, the fault stays until it's cleared if zero
+	Times int `json:"times,omitempty"`
+	// Number of requests the fault was applied to
+	Hits int `json:"hits"`
+}
+
+// UnmarshalJSON decodes a fault, the latency can be given as a duration string, e.g. "2s".
+func (f *Fault) UnmarshalJSON(data []byte) error {
+	type fault Fault
+	var raw struct {
+		fault
+		Latency interface{} `json:"latency,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*f = Fault(raw.fault)
+	latency, err := parseDuration(raw.Latency)
+	if err != nil {
+		return errors.Wrap(err, "invalid fault latency")
+	}
+	f.Latency = latency
+	return nil
+}
+
+// InjectFault adds a fault. Faults apply in the order they were added, the first
+// fault matching a request is used.
+func (m *Manager) InjectFault(f *Fault) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = append(m.faults, f)
+}
+
+// ClearFaults removes all the faults
+func (m *Manager) ClearFaults() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.faults = nil
+}
+
+// Faults returns a copy of the active faults
+func (m *Manager) Faults() []*Fault {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	faults := make([]*Fault, 0, len(m.faults))
+	for _, f := range m.faults {
+		c := *f
+		faults = append(faults, &c)
+	}
+	return faults
+}
+
+// fault returns the fault to apply to a request to the endpoint, if any. Used up faults are removed.
+func (m *Manager) fault(endpoint string) *Fault {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, f := range m.faults {
+		if f.Endpoint != "" && f.Endpoint != endpoint {
+			continue
+		}
+		f.Hits++
+		if f.Times > 0 && f.Hits >= f.Times {
+			m.faults = append(m.faults[:i:i], m.faults[i+1:]...)
+		}
+		c := *f
+		return &c
+	}
+	return nil
+}
+
+// parseDuration parses a duration given as a string, e.g. "1m30s", or as a number of nanoseconds
+func parseDuration(v interface{}) (time.Duration, error) {
+	switch d := v.(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return time.Duration(d), nil
+	case string:
+		return time.ParseDuration(d)
+	default:
+		return 0, errors.Errorf("expected a duration, got %v", v)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package mockmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harness/runner/delegateshell/client"
+)
+
+// Longest long poll of the runner events endpoint
+const maxLongPoll = time.Minute
+
+// Handler returns the handler serving the manager endpoints used by the runner, along with the admin endpoints
+func (m *Manager) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/agent/delegates/register", m.endpoint(EndpointRegister, m.handleRegister))
+	mux.HandleFunc("POST /api/agent/delegates/unregister", m.endpoint(EndpointUnregister, m.handleUnregister))
+	mux.HandleFunc("POST /api/agent/delegates/heartbeat-with-polling", m.endpoint(EndpointHeartbeat, m.handleHeartbeat))
+	mux.HandleFunc("GET /api/executions/{id}/runner-events", m.endpoint(EndpointRunnerEvents, m.handleRunnerEvents))
+	mux.HandleFunc("GET /api/executions/{id}/runner-events/stream", m.handleStream)
+	mux.HandleFunc("GET /api/executions/{id}/request", m.endpoint(EndpointExecutionPayload, m.handleExecutionPayload))
+	mux.HandleFunc("POST /api/executions/{id}/task-response", m.endpoint(EndpointTaskResponse, m.handleTaskResponse))
+	mux.HandleFunc("POST /api/executions/{id}/task-progress", m.endpoint(EndpointTaskProgress, m.handleTaskProgress))
+	mux.HandleFunc("POST /api/daemons/{id}/reconcile", m.endpoint(EndpointReconcile, m.handleReconcile))
+	mux.HandleFunc("POST /api/daemons/{id}/tasks", m.endpoint(EndpointAcquireTasks, m.handleAcquireTasks))
+	mux.HandleFunc("GET /api/agent/infra-download/delegate-auth/delegate/logging-token", m.endpoint(EndpointLoggingToken, m.handleLoggingToken))
+	m.handleAdmin(mux)
+	return mux
+}
+
+// handlerFunc serves a manager endpoint, it returns the status code and the body of the response
+type handlerFunc func(r *http.Request) (int, interface{})
+
+// endpoint wraps the handler of an endpoint: it checks the runner credentials, applies the faults
+// targeting the endpoint and records the call.
+func (m *Manager) endpoint(name string, h handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, body := m.serve(name, h, r)
+		m.record(name, r, status)
+		writeJSON(w, status, body)
+	}
+}
+
+func (m *Manager) serve(name string, h handlerFunc, r *http.Request) (int, interface{}) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Delegate ") {
+		return http.StatusUnauthorized, errorBody("missing runner token")
+	}
+	if accountID := r.URL.Query().Get("accountId"); accountID != m.accountID {
+		return http.StatusUnauthorized, errorBody(fmt.Sprintf("unknown account %q", accountID))
+	}
+	if f := m.fault(name); f != nil {
+		if f.Latency > 0 {
+			select {
+			case <-time.After(f.Latency):
+			case <-r.Context().Done():
+			}
+		}
+		if f.Status != 0 {
+			return f.Status, errorBody(fmt.Sprintf("injected fault: %s", http.StatusText(f.Status)))
+		}
+	}
+	return h(r)
+}
+
+func (m *Manager) handleRegister(r *http.Request) (int, interface{}) {
+	req := new(client.RegisterRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// A runner registering again keeps its ID
+	for id, runner := range m.runners {
+		if req.ID == "" && runner.RunnerName == req.RunnerName && runner.HostName == req.HostName {
+			req.ID = id
+		}
+	}
+	if req.ID == "" {
+		req.ID = fmt.Sprintf("runner-%d", len(m.runners)+1)
+	}
+	m.runners[req.ID] = req
+	return http.StatusOK, &client.RegisterResponse{Resource: client.RegistrationData{DelegateID: req.ID}}
+}
+
+func (m *Manager) handleUnregister(r *http.Request) (int, interface{}) {
+	req := new(client.UnregisterRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unregister = append(m.unregister, req)
+	delete(m.runners, req.ID)
+	return http.StatusOK, struct{}{}
+}
+
+func (m *Manager) handleHeartbeat(r *http.Request) (int, interface{}) {
+	req := new(client.RegisterRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.runners[req.ID]; !ok {
+		return http.StatusNotFound, errorBody(fmt.Sprintf("runner %s is not registered", req.ID))
+	}
+	m.runners[req.ID] = req
+	m.heartbeats = append(m.heartbeats, req)
+	return http.StatusOK, struct{}{}
+}
+
+func (m *Manager) handleRunnerEvents(r *http.Request) (int, interface{}) {
+	runnerID := r.PathValue("id")
+	events := m.events(runnerID)
+	if len(events) == 0 {
+		// The request is held open until an event arrives, as the manager does
+		if seconds, _ := strconv.Atoi(r.URL.Query().Get("waitSeconds")); seconds > 0 {
+			wait := time.Duration(seconds) * time.Second
+			if wait > maxLongPoll {
+				wait = maxLongPoll
+			}
+			deadline := time.Now().Add(wait)
+			for len(events) == 0 && time.Now().Before(deadline) && m.wait(r.Context(), time.Until(deadline)) {
+				events = m.events(runnerID)
+			}
+		}
+	}
+	return http.StatusOK, &client.RunnerEventsResponse{RunnerEvents: events}
+}
+
+func (m *Manager) handleExecutionPayload(r *http.Request) (int, interface{}) {
+	taskID := r.PathValue("id")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tasks[taskID]
+	if !ok || t.Daemon {
+		return http.StatusNotFound, errorBody(ErrTaskNotFound.Error())
+	}
+	if t.State != TaskQueued || t.Aborted {
+		return http.StatusConflict, errorBody(fmt.Sprintf("task %s is not available", taskID))
+	}
+	t.State = TaskAcquired
+	t.AcquiredBy = r.URL.Query().Get("delegateId")
+	return http.StatusOK, map[string]interface{}{"requests": t.Requests}
+}
+
+func (m *Manager) handleTaskResponse(r *http.Request) (int, interface{}) {
+	req := new(client.TaskResponse)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	taskID := r.PathValue("id")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tasks[taskID]
+	if !ok {
+		return http.StatusNotFound, errorBody(ErrTaskNotFound.Error())
+	}
+	t.Responses = append(t.Responses, req)
+	// A task with several requests gets one response per request
+	if len(t.Responses) >= len(t.Requests) {
+		t.State = TaskResponded
+	}
+	m.notify()
+	return http.StatusOK, struct{}{}
+}
+
+func (m *Manager) handleTaskProgress(r *http.Request) (int, interface{}) {
+	req := new(client.TaskProgress)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	taskID := r.PathValue("id")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tasks[taskID]
+	if !ok {
+		return http.StatusNotFound, errorBody(ErrTaskNotFound.Error())
+	}
+	t.Progress = append(t.Progress, req)
+	return http.StatusOK, struct{}{}
+}
+
+func (m *Manager) handleReconcile(r *http.Request) (int, interface{}) {
+	req := new(client.DaemonSetReconcileRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconciles = append(m.reconciles, req)
+	if m.daemonSets != nil {
+		return http.StatusOK, &client.DaemonSetReconcileResponse{Data: m.daemonSets}
+	}
+	resp := &client.DaemonSetReconcileResponse{Data: []client.DaemonSetServerInfo{}}
+	for _, e := range req.Data {
+		resp.Data = append(resp.Data, client.DaemonSetServerInfo{DaemonSetId: e.DaemonSetId, Type: e.Type, Config: e.Config, SkipUpdate: true})
+	}
+	return http.StatusOK, resp
+}
+
+func (m *Manager) handleAcquireTasks(r *http.Request) (int, interface{}) {
+	req := new(client.DaemonTaskAcquireRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	requests := []json.RawMessage{}
+	for _, id := range req.TaskIds {
+		t, ok := m.tasks[id]
+		if !ok || !t.Daemon {
+			continue
+		}
+		t.State = TaskAcquired
+		t.AcquiredBy = r.PathValue("id")
+		requests = append(requests, t.Requests...)
+	}
+	return http.StatusOK, map[string]interface{}{"requests": requests}
+}
+
+func (m *Manager) handleLoggingToken(r *http.Request) (int, interface{}) {
+	return http.StatusOK, &client.AccessTokenBeanResource{AccessTokenBean: &client.AccessTokenBean{
+		ProjectId:            "mock-project",
+		TokenValue:           "mock-token",
+		ExpirationTimeMillis: time.Now().Add(time.Hour).UnixMilli(),
+	}}
+}
+
+func errorBody(message string) interface{} {
+	return map[string]string{"message": message}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
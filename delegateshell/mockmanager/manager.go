@@ -0,0 +1,331 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+// Package mockmanager provides a fake Harness manager implementing the endpoints used by the
+// runner, so that the runner can be exercised end to end without a Harness environment.
+// Tasks are enqueued and faults injected through the Go API, the admin endpoints or a scenario,
+// and everything the runner sends is recorded so that it can be asserted on.
+package mockmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/pkg/errors"
+)
+
+// Endpoint names, used to target faults and to label the recorded calls
+const (
+	EndpointRegister     = "register"
+	EndpointUnregister   = "unregister"
+	EndpointHeartbeat    = "heartbeat"
+	EndpointRunnerEvents = "runner-events"
+	// The event stream, over a WebSocket or Server-Sent-Events connection
+	EndpointRunnerEventsStream = "runner-events-stream"
+	EndpointExecutionPayload   = "execution-payload"
+	EndpointTaskResponse       = "task-response"
+	EndpointTaskProgress       = "task-progress"
+	EndpointReconcile          = "daemon-reconcile"
+	EndpointAcquireTasks       = "daemon-tasks"
+	EndpointLoggingToken       = "logging-token"
+)
+
+// ErrTaskNotFound is returned for a task which was never enqueued
+var ErrTaskNotFound = errors.New("task not found")
+
+// TaskState is the state of a task in the manager
+type TaskState string
+
+// TaskState enumeration
+const (
+	TaskQueued    TaskState = "QUEUED"
+	TaskAcquired  TaskState = "ACQUIRED"
+	TaskResponded TaskState = "RESPONDED"
+)
+
+// Task is a task enqueued in the manager. Requests are the task requests as sent to the runner,
+// the timeout of a request is set in seconds in its task, e.g. {"id":"1","task":{"type":"local_init","timeout":60}}.
+type Task struct {
+	ID         string            `json:"id"`
+	Type       string            `json:"type"`
+	AccountID  string            `json:"accountId,omitempty"`
+	RunnerType string            `json:"runnerType,omitempty"`
+	Requests   []json.RawMessage `json:"requests"`
+	// Daemon tasks are not polled, they are acquired by the daemon set reconciler
+	Daemon bool `json:"daemon,omitempty"`
+
+	State      TaskState              `json:"state"`
+	Aborted    bool                   `json:"aborted,omitempty"`
+	AcquiredBy string                 `json:"acquiredBy,omitempty"`
+	Responses  []*client.TaskResponse `json:"responses,omitempty"`
+	Progress   []*client.TaskProgress `json:"progress,omitempty"`
+	// set once the abort event was sent to the runner
+	abortSent bool
+}
+
+// Call is a request received by the manager
+type Call struct {
+	Endpoint string    `json:"endpoint"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	Status   int       `json:"status"`
+	Time     time.Time `json:"time"`
+}
+
+// Manager is a fake Harness manager, it's safe for concurrent use.
+// It's served with its Handler, e.g. with httptest.NewServer(m.Handler()).
+type Manager struct {
+	accountID string
+
+	mu         sync.Mutex
+	runners    map[string]*client.RegisterRequest
+	heartbeats []*client.RegisterRequest
+	unregister []*client.UnregisterRequest
+	tasks      map[string]*Task
+	order      []string
+	reconciles []*client.DaemonSetReconcileRequest
+	daemonSets []client.DaemonSetServerInfo
+	faults     []*Fault
+	calls      []Call
+	// incremented to ask the runners for a reconciliation, or to drop the event streams
+	reconcileTriggers int
+	streamGeneration  int
+	// closed and replaced when a task is enqueued, aborted or responded to
+	changed chan struct{}
+}
+
+// New returns a manager serving the account accountID
+func New(accountID string) *Manager {
+	return &Manager{
+		accountID: accountID,
+		runners:   map[string]*client.RegisterRequest{},
+		tasks:     map[string]*Task{},
+		changed:   make(chan struct{}),
+	}
+}
+
+// Enqueue adds a task to the queue of the runners. An ID is given to the task if it has none,
+// the account defaults to the account of the manager.
+func (m *Manager) Enqueue(t *Task) (string, error) {
+	if len(t.Requests) == 0 {
+		return "", errors.New("a task needs at least one request")
+	}
+	t = t.copy()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if t.ID == "" {
+		t.ID = fmt.Sprintf("task-%d", len(m.order)+1)
+	}
+	if _, ok := m.tasks[t.ID]; ok {
+		return "", errors.Errorf("task %s already exists", t.ID)
+	}
+	if t.AccountID == "" {
+		t.AccountID = m.accountID
+	}
+	t.State = TaskQueued
+	m.tasks[t.ID] = t
+	m.order = append(m.order, t.ID)
+	m.notify()
+	return t.ID, nil
+}
+
+// Abort sends an abort event for a task to the runner which acquired it. A queued task is
+// removed from the queue instead.
+func (m *Manager) Abort(taskID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tasks[taskID]
+	if !ok {
+		return ErrTaskNotFound
+	}
+	t.Aborted = true
+	m.notify()
+	return nil
+}
+
+// SetDaemonSets sets the daemon sets the runners are expected to run, as returned by the reconcile endpoint.
+// Until it's called, the reconcile endpoint keeps the daemon sets reported by the runner.
+func (m *Manager) SetDaemonSets(daemonSets []client.DaemonSetServerInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.daemonSets = daemonSets
+}
+
+// Task returns a copy of a task, along with the responses and the progress received for it
+func (m *Manager) Task(taskID string) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tasks[taskID]
+	if !ok {
+		return nil, ErrTaskNotFound
+	}
+	return t.copy(), nil
+}
+
+// Tasks returns a copy of the tasks, in the order they were enqueued
+func (m *Manager) Tasks() []*Task {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tasks := make([]*Task, 0, len(m.order))
+	for _, id := range m.order {
+		tasks = append(tasks, m.tasks[id].copy())
+	}
+	return tasks
+}
+
+// Responses returns the responses received for a task
+func (m *Manager) Responses(taskID string) []*client.TaskResponse {
+	t, err := m.Task(taskID)
+	if err != nil {
+		return nil
+	}
+	return t.Responses
+}
+
+// WaitForResponses waits until a task got a response for each of its requests, and returns them.
+func (m *Manager) WaitForResponses(ctx context.Context, taskID string) ([]*client.TaskResponse, error) {
+	for {
+		m.mu.Lock()
+		t, ok := m.tasks[taskID]
+		if !ok {
+			m.mu.Unlock()
+			return nil, ErrTaskNotFound
+		}
+		if t.State == TaskResponded {
+			responses := t.copy().Responses
+			m.mu.Unlock()
+			return responses, nil
+		}
+		changed := m.changed
+		m.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "no response for task %s", taskID)
+		case <-changed:
+		}
+	}
+}
+
+// Runners returns the last registration or heartbeat of each runner, by runner ID
+func (m *Manager) Runners() map[string]*client.RegisterRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	runners := make(map[string]*client.RegisterRequest, len(m.runners))
+	for id, r := range m.runners {
+		c := *r
+		runners[id] = &c
+	}
+	return runners
+}
+
+// Heartbeats returns the heartbeats received, oldest first
+func (m *Manager) Heartbeats() []*client.RegisterRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*client.RegisterRequest(nil), m.heartbeats...)
+}
+
+// Unregistrations returns the unregister requests received
+func (m *Manager) Unregistrations() []*client.UnregisterRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*client.UnregisterRequest(nil), m.unregister...)
+}
+
+// Reconciles returns the daemon set reconcile requests received, oldest first
+func (m *Manager) Reconciles() []*client.DaemonSetReconcileRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*client.DaemonSetReconcileRequest(nil), m.reconciles...)
+}
+
+// Calls returns the requests received by the manager, oldest first
+func (m *Manager) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// State is a snapshot of the manager
+type State struct {
+	Runners    map[string]*client.RegisterRequest `json:"runners"`
+	Heartbeats int                                `json:"heartbeats"`
+	Tasks      []*Task                            `json:"tasks"`
+	Faults     []*Fault                           `json:"faults"`
+	Calls      map[string]int                     `json:"calls"`
+}
+
+// Snapshot returns the state of the manager, with the number of calls by endpoint and status
+func (m *Manager) Snapshot() *State {
+	s := &State{Runners: m.Runners(), Tasks: m.Tasks(), Faults: m.Faults(), Calls: map[string]int{}}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.Heartbeats = len(m.heartbeats)
+	for _, c := range m.calls {
+		s.Calls[fmt.Sprintf("%s %d", c.Endpoint, c.Status)]++
+	}
+	return s
+}
+
+// events returns the events of a runner: the queued tasks and the abort events of the tasks it acquired
+func (m *Manager) events(runnerID string) []*client.RunnerEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := []*client.RunnerEvent{}
+	for _, id := range m.order {
+		t := m.tasks[id]
+		switch {
+		case t.Daemon:
+		case t.State == TaskQueued && !t.Aborted:
+			events = append(events, &client.RunnerEvent{AccountID: t.AccountID, TaskID: t.ID, TaskType: t.Type, RunnerType: t.RunnerType})
+		case t.State == TaskAcquired && t.Aborted && !t.abortSent && t.AcquiredBy == runnerID:
+			t.abortSent = true
+			events = append(events, &client.RunnerEvent{AccountID: t.AccountID, TaskID: t.ID, TaskType: t.Type, EventType: client.RunnerEventTypeAbort})
+		}
+	}
+	return events
+}
+
+// wait waits for a change of the tasks, up to d. Returns false if nothing changed.
+func (m *Manager) wait(ctx context.Context, d time.Duration) bool {
+	m.mu.Lock()
+	changed := m.changed
+	m.mu.Unlock()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-changed:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return false
+}
+
+// notify wakes up the long polls and the waiters. Must be called with the lock held.
+func (m *Manager) notify() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *Manager) record(endpoint string, r *http.Request, status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, Call{Endpoint: endpoint, Method: r.Method, Path: r.URL.Path, Status: status, Time: time.Now()})
+}
+
+// copy returns a deep copy of the task, so that it can be used without the lock
+func (t *Task) copy() *Task {
+	c := *t
+	c.Requests = append([]json.RawMessage(nil), t.Requests...)
+	c.Responses = append([]*client.TaskResponse(nil), t.Responses...)
+	c.Progress = append([]*client.TaskProgress(nil), t.Progress...)
+	return &c
+}
@@ -0,0 +1,181 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package mockmanager
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/logger"
+	"github.com/pkg/errors"
+)
+
+// Time given to a task to get its responses when the expectation does not set a timeout
+var defaultExpectTimeout = 5 * time.Minute
+
+// Scenario is a script run against the manager, its steps run in order
+type Scenario struct {
+	Name  string  `json:"name,omitempty"`
+	Steps []*Step `json:"steps"`
+}
+
+// Step is a step of a scenario, it waits for After and then takes the actions it sets, in the order of the fields.
+type Step struct {
+	Name        string                       `json:"name,omitempty"`
+	After       time.Duration                `json:"after,omitempty"`
+	Enqueue     []*Task                      `json:"enqueue,omitempty"`
+	Abort       []string                     `json:"abort,omitempty"`
+	ClearFaults bool                         `json:"clearFaults,omitempty"`
+	Faults      []*Fault                     `json:"faults,omitempty"`
+	DaemonSets  []client.DaemonSetServerInfo `json:"daemonSets,omitempty"`
+	Reconcile   bool                         `json:"reconcile,omitempty"`
+	DropStreams bool                         `json:"dropStreams,omitempty"`
+	Expect      []*Expectation               `json:"expect,omitempty"`
+}
+
+// Expectation checks the responses of a task. The responses are waited for, up to the timeout.
+type Expectation struct {
+	TaskID string `json:"taskId"`
+	// Status code expected for every response of the task, if set
+	Code client.StatusCode `json:"code,omitempty"`
+	// Text expected in the error of every response of the task, if set
+	Error   string        `json:"error,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// UnmarshalJSON decodes a step, the delay can be given as a duration string, e.g. "10s".
+func (s *Step) UnmarshalJSON(data []byte) error {
+	type step Step
+	var raw struct {
+		step
+		After interface{} `json:"after,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*s = Step(raw.step)
+	after, err := parseDuration(raw.After)
+	if err != nil {
+		return errors.Wrap(err, "invalid step delay")
+	}
+	s.After = after
+	return nil
+}
+
+// UnmarshalJSON decodes an expectation, the timeout can be given as a duration string, e.g. "1m".
+func (e *Expectation) UnmarshalJSON(data []byte) error {
+	type expectation Expectation
+	var raw struct {
+		expectation
+		Timeout interface{} `json:"timeout,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*e = Expectation(raw.expectation)
+	timeout, err := parseDuration(raw.Timeout)
+	if err != nil {
+		return errors.Wrap(err, "invalid expectation timeout")
+	}
+	e.Timeout = timeout
+	return nil
+}
+
+// LoadScenario reads a scenario from a JSON file
+func LoadScenario(path string) (*Scenario, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := new(Scenario)
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, errors.Wrapf(err, "could not decode scenario %s", path)
+	}
+	return s, nil
+}
+
+// Run runs the steps of a scenario. It stops at the first step which fails, the error tells which expectation failed.
+func (m *Manager) Run(ctx context.Context, s *Scenario) error {
+	for i, step := range s.Steps {
+		name := step.Name
+		if name == "" {
+			name = "#" + strconv.Itoa(i+1)
+		}
+		if step.After > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(step.After):
+			}
+		}
+		logger.WithField(ctx, "step", name).Infoln("running scenario step")
+		if err := m.runStep(ctx, step); err != nil {
+			return errors.Wrapf(err, "step %s of scenario %s failed", name, s.Name)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) runStep(ctx context.Context, step *Step) error {
+	for _, t := range step.Enqueue {
+		if _, err := m.Enqueue(t); err != nil {
+			return err
+		}
+	}
+	for _, id := range step.Abort {
+		if err := m.Abort(id); err != nil {
+			return errors.Wrapf(err, "could not abort task %s", id)
+		}
+	}
+	if step.ClearFaults {
+		m.ClearFaults()
+	}
+	for _, f := range step.Faults {
+		m.InjectFault(f)
+	}
+	if step.DaemonSets != nil {
+		m.SetDaemonSets(step.DaemonSets)
+	}
+	if step.Reconcile {
+		m.TriggerReconcile()
+	}
+	if step.DropStreams {
+		m.DropStreams()
+	}
+	for _, e := range step.Expect {
+		if err := m.expect(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) expect(ctx context.Context, e *Expectation) error {
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = defaultExpectTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	responses, err := m.WaitForResponses(ctx, e.TaskID)
+	if err != nil {
+		return err
+	}
+	for _, r := range responses {
+		if e.Code != "" && r.Code != e.Code {
+			return errors.Errorf("task %s: expected status %s, got %s (%s)", e.TaskID, e.Code, r.Code, r.Error)
+		}
+		if e.Error != "" && !strings.Contains(r.Error, e.Error) {
+			return errors.Errorf("task %s: expected error containing %q, got %q", e.TaskID, e.Error, r.Error)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package mockmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/harness/runner/delegateshell/client"
+)
+
+// Interval between two pings on the event streams
+var streamPingInterval = 15 * time.Second
+
+var upgrader = websocket.Upgrader{}
+
+// TriggerReconcile asks the runners connected to an event stream for a daemon set reconciliation
+func (m *Manager) TriggerReconcile() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reconcileTriggers++
+	m.notify()
+}
+
+// DropStreams closes the event streams which are open, the runners have to reconnect
+func (m *Manager) DropStreams() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streamGeneration++
+	m.notify()
+}
+
+// handleStream pushes the runner events over a WebSocket connection, or as Server-Sent-Events.
+// Every event is pushed once per connection, along with the reconcile triggers and a periodic ping.
+func (m *Manager) handleStream(w http.ResponseWriter, r *http.Request) {
+	status, body := m.serve(EndpointRunnerEventsStream, func(*http.Request) (int, interface{}) { return http.StatusOK, nil }, r)
+	m.record(EndpointRunnerEventsStream, r, status)
+	if status != http.StatusOK {
+		writeJSON(w, status, body)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	var send func(msg *client.StreamMessage) error
+	if websocket.IsWebSocketUpgrade(r) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// The control frames of the runner are only processed while reading
+		go func() {
+			defer cancel()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+		send = func(msg *client.StreamMessage) error {
+			return conn.WriteJSON(msg)
+		}
+	} else {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeJSON(w, http.StatusInternalServerError, errorBody("streaming is not supported"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		send = func(msg *client.StreamMessage) error {
+			b, err := json.Marshal(msg)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, b); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+	}
+	m.stream(ctx, r.PathValue("id"), send)
+}
+
+func (m *Manager) stream(ctx context.Context, runnerID string, send func(msg *client.StreamMessage) error) {
+	m.mu.Lock()
+	generation := m.streamGeneration
+	triggers := m.reconcileTriggers
+	m.mu.Unlock()
+
+	pushed := map[string]bool{}
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+	for {
+		m.mu.Lock()
+		changed := m.changed
+		dropped := m.streamGeneration != generation
+		reconcile := m.reconcileTriggers != triggers
+		triggers = m.reconcileTriggers
+		m.mu.Unlock()
+		if dropped {
+			return
+		}
+		var events []*client.RunnerEvent
+		for _, e := range m.events(runnerID) {
+			key := e.TaskID + "/" + string(e.EventType)
+			if !pushed[key] {
+				pushed[key] = true
+				events = append(events, e)
+			}
+		}
+		if len(events) > 0 {
+			if send(&client.StreamMessage{Type: client.StreamMessageRunnerEvents, RunnerEvents: events}) != nil {
+				return
+			}
+		}
+		if reconcile {
+			if send(&client.StreamMessage{Type: client.StreamMessageReconcile}) != nil {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-ping.C:
+			if send(&client.StreamMessage{Type: client.StreamMessagePing}) != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/google/uuid"
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/logger"
+	"github.com/harness/runner/utils"
+	"github.com/pkg/errors"
+)
+
+var (
+	// Maximum time spent retrying a response before leaving it to the background replay
+	sendTimeout = 2 * time.Minute
+	// Time period between replays of the responses which are not acknowledged yet
+	replayInterval = 1 * time.Minute
+	// Responses older than this are dropped, the manager has given up on the task by then
+	maxAge = 24 * time.Hour
+	// A response the manager does not find the runner or the task for is kept this long: the manager may have
+	// lost the registration of the runner, the response goes through once the runner registered again
+	notFoundGrace = 10 * time.Minute
+)
+
+const fileExt = ".json"
+
+// entry is a task response persisted on disk until the manager acknowledges it. A task with several requests
+// sends a response per request, every response gets its own entry.
+type entry struct {
+	ID        string               `json:"id"`
+	TaskID    string               `json:"taskId"`
+	Response  *client.TaskResponse `json:"response"`
+	CreatedAt time.Time            `json:"createdAt"`
+}
+
+// DelegateIDFn returns the ID the runner is currently registered with
+type DelegateIDFn func() string
+
+// Outbox makes sure task responses reach the manager. A response is written to disk
+// before it's sent, and it's only removed once the manager acknowledges it. Responses
+// left over from a previous run are replayed on start.
+type Outbox struct {
+	dir    string
+	client client.Client
+	// the responses are sent with the current runner ID, it changes when the runner registers again
+	delegateID DelegateIDFn
+	// IDs of the entries which are being sent, so that the replay does not send them twice
+	sending sync.Map
+}
+
+func New(dir string, c client.Client, delegateID DelegateIDFn) *Outbox {
+	return &Outbox{
+		dir:        dir,
+		client:     c,
+		delegateID: delegateID,
+	}
+}
+
+// Send persists the task response and sends it to the manager, retrying with backoff.
+// If the response can't be delivered in time, it's kept on disk and retried in the background.
+// A response the manager rejects is dropped, sending it again would not change the outcome.
+// An error is returned only if the response could neither be persisted nor delivered.
+func (o *Outbox) Send(ctx context.Context, taskID string, r *client.TaskResponse) error {
+	e := &entry{ID: taskID + "." + uuid.NewString(), TaskID: taskID, Response: r, CreatedAt: time.Now()}
+	persistErr := o.write(e)
+	if persistErr != nil {
+		logger.WithError(ctx, persistErr).Errorln("could not persist task response, sending it without a backup")
+	}
+
+	o.sending.Store(e.ID, true)
+	defer o.sending.Delete(e.ID)
+	if err := o.send(ctx, e); err != nil {
+		if rejected(err) {
+			logger.WithError(ctx, err).Errorln("task response was rejected by the manager, dropping it")
+			o.remove(ctx, e.ID)
+			return nil
+		}
+		if persistErr != nil {
+			return errors.Wrap(err, "could not send task response")
+		}
+		logger.WithError(ctx, err).Warnln("could not send task response, it will be retried in the background")
+		return nil
+	}
+	o.remove(ctx, e.ID)
+	return nil
+}
+
+// Start replays the responses which are not acknowledged yet, right away and then periodically.
+func (o *Outbox) Start(ctx context.Context) error {
+	if err := os.MkdirAll(o.dir, 0o700); err != nil {
+		return errors.Wrap(err, "could not create outbox directory")
+	}
+	go func() {
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Infoln(ctx, "context canceled, stopping task response replay")
+				return
+			case <-timer.C:
+				o.replay(ctx)
+				timer.Reset(replayInterval)
+			}
+		}
+	}()
+	logger.Infof(ctx, "Initialized task response outbox at %s", o.dir)
+	return nil
+}
+
+// replay sends every pending response found on disk
+func (o *Outbox) replay(ctx context.Context) {
+	entries, err := o.list()
+	if err != nil {
+		logger.WithError(ctx, err).Errorln("could not list pending task responses")
+		return
+	}
+	for _, e := range entries {
+		if _, loaded := o.sending.LoadOrStore(e.ID, true); loaded {
+			continue
+		}
+		entryCtx := logger.AddLogLabelsToContext(ctx, map[string]string{"task_id": e.TaskID})
+		if time.Since(e.CreatedAt) > maxAge {
+			logger.Warnln(entryCtx, "dropping task response which could not be delivered in time")
+			o.remove(entryCtx, e.ID)
+		} else if err := o.send(entryCtx, e); rejected(err) || (notFound(err) && time.Since(e.CreatedAt) > notFoundGrace) {
+			logger.WithError(entryCtx, err).Errorln("task response was rejected by the manager, dropping it")
+			o.remove(entryCtx, e.ID)
+		} else if err != nil {
+			logger.WithError(entryCtx, err).Warnln("could not replay task response")
+		} else {
+			logger.Infoln(entryCtx, "replayed task response")
+			o.remove(entryCtx, e.ID)
+		}
+		o.sending.Delete(e.ID)
+	}
+}
+
+func (o *Outbox) send(ctx context.Context, e *entry) error {
+	exp := backoff.NewExponentialBackOff()
+	exp.MaxElapsedTime = sendTimeout
+	return backoff.RetryNotify(func() error {
+		err := o.client.SendStatus(ctx, o.delegateID(), e.TaskID, e.Response)
+		if rejected(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(exp, ctx), func(err error, d time.Duration) {
+		logger.WithError(ctx, err).Warnf("could not send task response, retrying in %s", d)
+	})
+}
+
+// write persists the entry atomically, so that a crash never leaves a partial file behind
+func (o *Outbox) write(e *entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(o.path(e.ID), b)
+}
+
+// rejected tells whether the manager turned the response down for good. Authorization failures are retried,
+// they go away once the runner's token is valid again, and so are the responses not found, see notFound.
+func rejected(err error) bool {
+	var statusErr *client.StatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	switch statusErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return statusErr.StatusCode >= 400 && statusErr.StatusCode < 500
+}
+
+// notFound tells whether the manager did not find the runner or the task of the response. It answers so
+// until the runner registered again when it lost the registration of the runner, the response is only
+// dropped once this lasted longer than the registration takes.
+func notFound(err error) bool {
+	var statusErr *client.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound
+}
+
+func (o *Outbox) list() ([]*entry, error) {
+	files, err := os.ReadDir(o.dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []*entry
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), fileExt) {
+			continue
+		}
+		path := filepath.Join(o.dir, f.Name())
+		b, err := os.ReadFile(path)
+		if err != nil {
+			logger.WithError(context.TODO(), err).Errorf("could not read pending task response %s", path)
+			continue
+		}
+		e := new(entry)
+		if err := json.Unmarshal(b, e); err != nil {
+			logger.WithError(context.TODO(), err).Errorf("removing corrupted task response %s", path)
+			os.Remove(path)
+			continue
+		}
+		// Entries written by older runners are keyed by their task ID only
+		if e.ID == "" {
+			e.ID, _ = url.PathUnescape(strings.TrimSuffix(f.Name(), fileExt))
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (o *Outbox) remove(ctx context.Context, id string) {
+	if err := os.Remove(o.path(id)); err != nil && !os.IsNotExist(err) {
+		logger.WithError(ctx, err).Errorln("could not remove acknowledged task response")
+	}
+}
+
+func (o *Outbox) path(id string) string {
+	return filepath.Join(o.dir, url.PathEscape(id)+fileExt)
+}
@@ -0,0 +1,22 @@
+package outbox
+
+import (
+	"path/filepath"
+
+	"github.com/google/wire"
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/delegateshell/delegate"
+)
+
+// WireSet is a Wire provider set that provides an Outbox.
+var WireSet = wire.NewSet(
+	ProvideOutbox,
+)
+
+// ProvideOutbox is a Wire provider function that creates an Outbox.
+func ProvideOutbox(
+	config *delegate.Config,
+	managerClient client.Client,
+) *Outbox {
+	return New(filepath.Join(config.CacheLocation, "outbox"), managerClient, config.GetDelegateID)
+}
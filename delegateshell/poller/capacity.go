@@ -0,0 +1,134 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package poller
+
+import "sync"
+
+// capacity keeps track of the tasks taken up by the poller, so that the poller
+// only takes as many events as it can serve right away. Slots can be reserved for
+// priority classes, the tasks of the other classes share the remaining slots.
+type capacity struct {
+	mu       sync.Mutex
+	max      int
+	running  int
+	reserved []int
+	// number of slots in use by class
+	used []int
+}
+
+// setMax sets the maximum number of tasks which can run at the same time.
+// The number of parallel workers is further limited by maxStages, if set.
+// reserved holds the number of slots reserved for each class, at least one
+// slot is left to share between the classes.
+func (c *capacity) setMax(workers int, maxStages *int, reserved []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.max = workers
+	if maxStages != nil && *maxStages > 0 && *maxStages < workers {
+		c.max = *maxStages
+	}
+	c.reserved = make([]int, len(reserved))
+	c.used = make([]int, len(reserved))
+	left := c.max - 1
+	for class, r := range reserved {
+		if r > left {
+			r = left
+		}
+		if r > 0 {
+			c.reserved[class] = r
+			left -= r
+		}
+	}
+}
+
+// tryAcquire reserves a slot for a task of a class. It returns false if the runner is full for the class.
+func (c *capacity) tryAcquire(class int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running >= c.max {
+		return false
+	}
+	if c.used[class] >= c.reserved[class] && c.sharedInUse() >= c.shared() {
+		return false
+	}
+	c.used[class]++
+	c.running++
+	return true
+}
+
+// release frees a slot reserved with tryAcquire.
+func (c *capacity) release(class int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.used[class] > 0 {
+		c.used[class]--
+	}
+	if c.running > 0 {
+		c.running--
+	}
+}
+
+// shared returns the number of slots which are not reserved. Must be called with the lock held.
+func (c *capacity) shared() int {
+	n := c.max
+	for _, r := range c.reserved {
+		n -= r
+	}
+	return n
+}
+
+// sharedInUse returns the number of slots used beyond the reservations. Must be called with the lock held.
+func (c *capacity) sharedInUse() int {
+	n := 0
+	for class, used := range c.used {
+		if used > c.reserved[class] {
+			n += used - c.reserved[class]
+		}
+	}
+	return n
+}
+
+// free returns the number of tasks which can still be taken up.
+func (c *capacity) free() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.max - c.running
+}
+
+// inUse returns the number of tasks which are running or waiting for a worker.
+func (c *capacity) inUse() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running
+}
+
+// taskCounts keeps the number of running tasks by task type
+type taskCounts struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (t *taskCounts) add(taskType string, delta int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.counts == nil {
+		t.counts = map[string]int{}
+	}
+	t.counts[taskType] += delta
+	if t.counts[taskType] <= 0 {
+		delete(t.counts, taskType)
+	}
+}
+
+func (t *taskCounts) snapshot() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counts := make(map[string]int, len(t.counts))
+	for taskType, n := range t.counts {
+		counts[taskType] = n
+	}
+	return counts
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package poller
+
+import (
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/harness/runner/delegateshell/delegate"
+)
+
+// Jitter applied to idle intervals, so that runners started together do not poll in lockstep
+const idleRandomizationFactor = 0.2
+
+// pollInterval computes the wait before the next poll from the outcome of the previous one.
+// Polling speeds up right after events arrive, slows down while the runner is idle and backs
+// off exponentially, with jitter, while the manager is failing.
+type pollInterval struct {
+	config   delegate.PollingConfig
+	idle     *backoff.ExponentialBackOff
+	failures *backoff.ExponentialBackOff
+}
+
+func newPollInterval(config delegate.PollingConfig) *pollInterval {
+	if config.MinInterval <= 0 || config.MinInterval > config.Interval {
+		config.MinInterval = config.Interval
+	}
+	if config.IdleMaxInterval < config.Interval {
+		config.IdleMaxInterval = config.Interval
+	}
+	if config.ErrorMaxInterval < config.Interval {
+		config.ErrorMaxInterval = config.Interval
+	}
+
+	idle := backoff.NewExponentialBackOff()
+	idle.InitialInterval = config.Interval
+	idle.MaxInterval = config.IdleMaxInterval
+	idle.RandomizationFactor = idleRandomizationFactor
+	idle.MaxElapsedTime = 0
+	idle.Reset()
+
+	failures := backoff.NewExponentialBackOff()
+	failures.InitialInterval = config.Interval
+	failures.MaxInterval = config.ErrorMaxInterval
+	failures.MaxElapsedTime = 0
+	failures.Reset()
+
+	return &pollInterval{config: config, idle: idle, failures: failures}
+}
+
+// initial returns the wait before the first poll
+func (i *pollInterval) initial() time.Duration {
+	return i.config.Interval
+}
+
+// failed returns the wait after a poll which failed
+func (i *pollInterval) failed() time.Duration {
+	i.idle.Reset()
+	return i.failures.NextBackOff()
+}
+
+// succeeded returns the wait after a poll which returned the given number of events
+func (i *pollInterval) succeeded(events int) time.Duration {
+	i.failures.Reset()
+	if events > 0 {
+		i.idle.Reset()
+		return i.config.MinInterval
+	}
+	// The manager already held the request open while there was nothing to do
+	if i.config.LongPoll > 0 {
+		return i.config.MinInterval
+	}
+	return i.idle.NextBackOff()
+}
@@ -9,6 +9,7 @@ import (
 	"context"
 	"encoding/json"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/harness/runner/logger"
@@ -18,38 +19,99 @@ import (
 	"github.com/drone/go-task/task"
 	"github.com/harness/lite-engine/api"
 	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/delegateshell/journal"
+	"github.com/harness/runner/delegateshell/lease"
+	"github.com/harness/runner/delegateshell/outbox"
+	"github.com/harness/runner/delegateshell/progress"
 	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
 )
 
 var (
 	taskEventsTimeout = 30 * time.Second
+
+	// ErrTaskAborted is the cancellation cause of a task which was aborted by the manager
+	ErrTaskAborted = errors.New("task aborted by the manager")
+	// ErrTaskTimedOut is the cancellation cause of a task which did not complete before its deadline
+	ErrTaskTimedOut = errors.New("task timed out")
+	// ErrTaskInterrupted is the failure of a task which was running when the runner stopped
+	ErrTaskInterrupted = errors.New("task was interrupted by a runner restart")
+	// ErrRunnerShuttingDown is the cancellation cause of a task which did not complete before the drain deadline
+	ErrRunnerShuttingDown = errors.New("runner shutting down")
+	// ErrRequestRejected is the failure of a request whose task type is turned down by the filter rules
+	ErrRequestRejected = errors.New("request rejected by the filter rules")
+
+	// Time given to the tasks cancelled at the drain deadline to report their failure
+	abortGracePeriod = 10 * time.Second
 )
 
 type FilterFn func(*client.RunnerEvent) bool
 
+// RequestFilterFn returns nil if a request of the task type can run on this runner, or the reason why it can't.
+// The event only tells the task type of its first request, the requests of the payload are checked again.
+type RequestFilterFn func(accountID, taskType, runnerType string) error
+
+// ObserveFn is given the task events in observe-only mode, instead of processing them.
+// allowed tells whether the event passed the filter rules.
+type ObserveFn func(ctx context.Context, e *client.RunnerEvent, allowed bool)
+
 type Poller struct {
 	UseV2Status   bool
 	RemoteLogging bool
 	Client        client.Client
+	Outbox        *outbox.Outbox
+	Journal       *journal.Journal
+	Leases        *lease.Store
 	router        *task.Router
 	Metrics       metrics.Metrics
 	Filter        FilterFn
+	RequestFilter RequestFilterFn
+	Observe       ObserveFn
+	Timeouts      delegate.TimeoutConfig
+	Capacity      delegate.CapacityConfig
+	Polling       delegate.PollingConfig
+	Scheduling    delegate.SchedulingConfig
+	capacity      capacity
+	running       taskCounts
+	priorities    *priorities
 	stopChannel   chan struct{}
 	doneChannel   chan struct{}
+	// Run the requests of a multi-request payload concurrently
+	ParallelRequests bool
+	// Minimum time between two progress events of a task sent to the manager, zero disables them
+	ProgressInterval time.Duration
+	// Called when the manager asks for a daemon set reconciliation over the event stream
+	reconcile func()
+	// ID the runner events are polled with, polling is paused while the runner registers again
+	registration registration
+	// Set while the poller shuts down, to report what happened to the in progress tasks
+	drain atomic.Pointer[drain]
+	// Set once the drain deadline passed, the tasks which were not started yet are skipped
+	aborting atomic.Bool
 	// The Harness manager allows two task acquire calls with the same delegate ID to go through (by design).
 	// We need to make sure two different threads do not acquire the same task.
 	// This map makes sure Acquire() is called only once per task ID. The mapping is removed once the status
-	// for the task has been sent.
+	// for the task has been sent. The value is the cancel function of the task's context, which is used to
+	// abort the task.
 	m sync.Map
 }
 
-func New(c client.Client, router *task.Router, metrics metrics.Metrics, remoteLogging bool) *Poller {
+func New(c client.Client, o *outbox.Outbox, j *journal.Journal, leases *lease.Store, router *task.Router, metrics metrics.Metrics, remoteLogging bool, timeouts delegate.TimeoutConfig, capacity delegate.CapacityConfig, polling delegate.PollingConfig, scheduling delegate.SchedulingConfig) *Poller {
 	p := &Poller{
 		Client:        c,
+		Outbox:        o,
+		Journal:       j,
+		Leases:        leases,
 		router:        router,
 		Metrics:       metrics,
 		m:             sync.Map{},
 		RemoteLogging: remoteLogging,
+		Timeouts:      timeouts,
+		Capacity:      capacity,
+		Polling:       polling,
+		Scheduling:    scheduling,
+		priorities:    newPriorities(scheduling.Classes),
 	}
 	p.stopChannel = make(chan struct{})
 	p.doneChannel = make(chan struct{})
@@ -60,71 +122,166 @@ func (p *Poller) SetFilter(filter FilterFn) {
 	p.Filter = filter
 }
 
+// SetRequestFilter sets the function checking each request of a fetched payload before it runs
+func (p *Poller) SetRequestFilter(filter RequestFilterFn) {
+	p.RequestFilter = filter
+}
+
+// SetReconcileTrigger sets the function called when the manager asks for a daemon set reconciliation over the event stream
+func (p *Poller) SetReconcileTrigger(reconcile func()) {
+	p.reconcile = reconcile
+}
+
+// eventSource returns the source of the runner events: the event stream of the manager if the transport is set and
+// the client supports it, polling otherwise.
+func (p *Poller) eventSource(ctx context.Context, interval *pollInterval, runnerID string) EventSource {
+	poll := newPollSource(p.Client, interval, func() bool { return p.capacity.free() > 0 })
+	if p.Polling.Transport == "" || p.Polling.Transport == delegate.TransportPoll {
+		return poll
+	}
+	streamer, ok := p.Client.(client.Streamer)
+	if !ok {
+		logger.Warnf(ctx, "The task server does not support the %s event transport, polling for task events", p.Polling.Transport)
+		return poll
+	}
+	stream := newStreamSource(poll, streamer, p.Polling.Transport, p.Polling.Resync, p.reconcile)
+	stream.start(ctx, runnerID)
+	return stream
+}
+
+// SetObserver switches the poller to observe-only mode: task events are handed to observe, they are never acquired
+func (p *Poller) SetObserver(observe ObserveFn) {
+	p.Observe = observe
+}
+
+// RunningTasksByType returns the number of requests which are running on this runner, by task type
+func (p *Poller) RunningTasksByType() map[string]int {
+	return p.running.snapshot()
+}
+
+// Pause stops polling for runner events until Resume is called, the poll in progress is given up.
+// The tasks in progress keep running.
+func (p *Poller) Pause() {
+	p.registration.pause()
+}
+
+// Resume polls for the runner events again, with the ID the runner is now registered with
+func (p *Poller) Resume(id string) {
+	p.registration.resume(id)
+}
+
+// RunningTasks returns the number of tasks which are running or waiting for a worker on this runner
+func (p *Poller) RunningTasks() int {
+	return p.capacity.inUse()
+}
+
 // PollRunnerEvents continually asks the task server for tasks to execute.
-func (p *Poller) PollRunnerEvents(ctx context.Context, n int, id, name string, interval time.Duration) error {
+// The wait between two polls adapts to the outcome of the previous poll.
+func (p *Poller) PollRunnerEvents(ctx context.Context, n int, id, name string) error {
 
-	events := make(chan *client.RunnerEvent, n)
 	var wg sync.WaitGroup
+	p.registration.resume(id)
+	p.capacity.setMax(n, p.Capacity.MaxStages, p.priorities.reserved)
+	interval := newPollInterval(p.Polling)
+	scheduler := newScheduler(p.Scheduling, p.priorities)
 
 	// Task event poller
 	go func() {
-		defer close(events)
-		pollTimer := time.NewTimer(interval)
-		defer pollTimer.Stop()
-
-		for {
-			pollTimer.Reset(interval)
+		defer scheduler.close()
+		// Stopping the poller stops asking for task events. The tasks which are already in progress are left to complete.
+		pollCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() {
 			select {
-			case <-ctx.Done():
-				logger.Errorln(ctx, "context canceled during task polling, this should not happen")
-				return
 			case <-p.stopChannel:
 				logger.Infoln(ctx, "Request received to stop the poller")
-				// Note: The goal here is to stop the poller from acquiring new tasks,
-				// but we want to allow any ongoing tasks that were already in progress to complete.
-				if !pollTimer.Stop() {
-					// We attempt to stop the timer. If `pollTimer.Stop()` returns `false`,
-					// it means the timer was either already triggered or is currently firing.
-					// In this case, there might be an event pending on the channel `pollTimer.C`.
-					// To ensure that no timer events are left unprocessed before stopping the poller,
-					// we need to drain the channel by waiting to receive the event from `pollTimer.C`
-
-					logger.Infoln(ctx, "Waiting for any ongoing events to complete")
-					<-pollTimer.C
+				cancel()
+			case <-pollCtx.Done():
+			}
+		}()
+
+		source := p.eventSource(pollCtx, interval, id)
+		for {
+			nextCtx, cancelNext, runnerID, err := p.registration.poll(pollCtx)
+			var taskEvents []*client.RunnerEvent
+			if err == nil {
+				taskEvents, err = source.Next(nextCtx, runnerID)
+				cancelNext()
+			}
+			if pollCtx.Err() != nil {
+				select {
+				case <-p.stopChannel:
+					logger.Infoln(ctx, "Task polling has been stopped")
+				default:
+					logger.Errorln(ctx, "context canceled during task polling, this should not happen")
 				}
-				logger.Infoln(ctx, "Task polling has been stopped")
 				return
-			case <-pollTimer.C:
-				taskEventsCtx, cancelFn := context.WithTimeout(ctx, taskEventsTimeout)
-				tasks, err := p.Client.GetRunnerEvents(taskEventsCtx, id)
-				if err != nil {
-					logger.WithError(ctx, err).Errorf("could not query for task events")
+			}
+			if err != nil {
+				// Polling was paused while the runner registers again, or a catch-up poll of the stream failed
+				continue
+			}
+
+			var events []*client.RunnerEvent
+			for _, e := range taskEvents {
+				// Abort events are handled right away, they must not wait behind other tasks for a free worker
+				if e.EventType == client.RunnerEventTypeAbort {
+					p.abort(ctx, e.TaskID)
+					continue
 				}
-				cancelFn()
-
-				for _, e := range tasks.RunnerEvents {
-					select {
-					case events <- e:
-						// Event successfully sent to the channel
-					case <-ctx.Done():
-						logger.Errorln(ctx, "context canceled during event processing, this should not happen")
-						return
-					}
+				allowed := p.Filter == nil || p.Filter(e)
+				if p.Observe != nil {
+					p.Observe(ctx, e, allowed)
+					continue
+				}
+				// Rejected events are skipped before their payload is fetched, they are left for other runners
+				if !allowed {
+					logger.WithFields(ctx, map[string]interface{}{"task_id": e.TaskID, "account_id": e.AccountID, "task_type": e.TaskType}).
+						Infoln("Task event rejected by the filter rules, skipping it")
+					p.Metrics.IncrementTaskRejectedCount(e.AccountID, e.TaskType, name)
+					continue
 				}
+				events = append(events, e)
+			}
+			// Events which cannot be served right away are not buffered, they are left for other runners
+			skipped := scheduler.offer(events, p.capacity.tryAcquire)
+			for _, e := range skipped {
+				logger.WithFields(ctx, map[string]interface{}{"task_id": e.TaskID, "account_id": e.AccountID}).
+					Debugln("Runner is at full capacity, skipping task event")
+			}
+			if len(skipped) > 0 {
+				source.Skipped()
 			}
 		}
 	}()
-	// Task event processor. Start n threads to process events from the channel
+	// Task event processor. Start n threads to process events from the scheduler
 	for i := 0; i < n; i++ {
 		wg.Add(1)
 		go func(i int) {
 			defer wg.Done()
-			for acquiredTask := range events { // Read from events channel until it's closed
-				ctx = logger.AddLogLabelsToContext(ctx, map[string]string{"task_id": acquiredTask.TaskID})
-				err := p.process(ctx, id, name, *acquiredTask)
-				if err != nil {
-					logger.WithError(ctx, err).Errorf("[Thread %d]: runner [%s] could not process request", i, id)
+			for { // Read from the scheduler until it's closed
+				item, ok := scheduler.next()
+				if !ok {
+					return
+				}
+				acquiredTask := item.event
+				p.Metrics.ObserveTaskQueueTime(p.priorities.name(item.class), name, time.Since(item.queuedAt).Seconds())
+				taskCtx := logger.AddLogLabelsToContext(ctx, map[string]string{"task_id": acquiredTask.TaskID})
+				if p.aborting.Load() {
+					// The task is not acquired yet, it's left for other runners
+					logger.Infoln(taskCtx, "Runner is shutting down, skipping task event")
+				} else {
+					runnerID := p.registration.current()
+					err := p.process(taskCtx, runnerID, name, *acquiredTask)
+					if err != nil {
+						logger.WithError(taskCtx, err).Errorf("[Thread %d]: runner [%s] could not process request", i, runnerID)
+					}
+					if d := p.drain.Load(); d != nil {
+						d.done(acquiredTask.TaskID)
+					}
 				}
+				scheduler.done(acquiredTask)
+				p.capacity.release(item.class)
 			}
 		}(i)
 	}
@@ -138,66 +295,302 @@ func (p *Poller) PollRunnerEvents(ctx context.Context, n int, id, name string, i
 // execute tries to acquire the task and executes the handler for it
 func (p *Poller) process(ctx context.Context, delegateID, delegateName string, rv client.RunnerEvent) error {
 	taskID := rv.TaskID
-	if _, loaded := p.m.LoadOrStore(taskID, true); loaded {
+	// The task's context is not cancelled along with the runner's one, so that the task can complete
+	// while the runner drains. It's cancelled explicitly if the task is aborted or the drain deadline passes.
+	ctx, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	defer cancel(nil)
+	if _, loaded := p.m.LoadOrStore(taskID, cancel); loaded {
 		return nil
 	}
 	defer p.m.Delete(taskID)
 
+	// The in-memory map does not survive restarts, the lease store tells whether the task already ran on this runner
+	l, err := p.Leases.Get(taskID)
+	if err != nil {
+		logger.WithError(ctx, err).Warnln("could not read task lease")
+	}
+	if l != nil && l.State == lease.StateResponded {
+		logger.Infoln(ctx, "Task was already executed on this runner, skipping it")
+		return nil
+	}
+	if l != nil && l.State == lease.StateRunning {
+		// Running the task again is not safe, it may not be idempotent
+		logger.Warnln(ctx, "Task was interrupted by a runner restart, sending failed status")
+		// The record of the interrupted run is kept if the journal still has it
+		if _, err := p.Journal.Get(taskID); errors.Is(err, journal.ErrNotFound) {
+			p.beginJournal(ctx, rv)
+		}
+		taskResponse := &client.TaskResponse{ID: taskID, Type: rv.TaskType}
+		if err := setFailure(taskResponse, ErrTaskInterrupted); err != nil {
+			return err
+		}
+		if err := p.respond(ctx, taskResponse); err != nil {
+			return err
+		}
+		p.setLease(ctx, taskID, lease.StateResponded)
+		return nil
+	}
+	p.setLease(ctx, taskID, lease.StateAcquired)
+	p.beginJournal(ctx, rv)
+
 	payloads, err := p.Client.GetExecutionPayload(ctx, delegateID, delegateName, taskID)
 	if err != nil {
-		return errors.Wrap(err, "failed to get payload")
-	}
-	// Since task id is unique, it's just one request
-	for _, request := range payloads.Requests {
-		p.Metrics.IncrementTaskRunningCount(rv.AccountID, rv.TaskType, delegateName)
-		defer p.Metrics.DecrementTaskRunningCount(rv.AccountID, rv.TaskType, delegateName)
-		start_time := time.Now()
-
-		// TODO set the task id in runner request translator
-		// task id is required by the lite engine to send the response to the manager for hosted builds
-		request.Task.ID = rv.TaskID
-		resp := p.router.Handle(ctx, request)
-		p.Metrics.SetTaskExecutionTime(rv.AccountID, rv.TaskType, rv.TaskID, delegateName, metricsutils.CalculateDuration(start_time))
-		if resp == nil {
-			continue
+		err = errors.Wrap(err, "failed to get payload")
+		if err := p.Journal.Finish(taskID, string(client.StatusCodeFailed), err.Error(), 0); err != nil {
+			logger.WithError(ctx, err).Warnln("could not record task outcome in the journal")
 		}
-		taskResponse := &client.TaskResponse{ID: rv.TaskID, Type: request.Task.Type}
-		p.Metrics.IncrementTaskCompletedCount(rv.AccountID, rv.TaskType, delegateName)
-
-		if resp.Error() != nil {
-			taskResponse.Code = client.StatusCodeFailed
-			logger.WithError(ctx, resp.Error()).Error("Process task failed")
-			taskResponse.Error = resp.Error().Error()
-			p.Metrics.IncrementTaskFailedCount(rv.AccountID, rv.TaskType, delegateName)
-			// TODO: a bug here. If the Data is nil, exception happen in cg manager.
-			// This will be taken care after integrating with new response workflow
-			if respBytes, err := json.Marshal(&api.VMTaskExecutionResponse{ErrorMessage: resp.Error().Error()}); err == nil {
-				taskResponse.Data = respBytes
+		return err
+	}
+	p.setLease(ctx, taskID, lease.StateRunning)
+	if p.ProgressInterval > 0 {
+		// Handlers report their progress through the context, it's relayed to the manager until the task completes
+		relay := newProgressRelay(ctx, p.Client, delegateID, taskID, p.ProgressInterval)
+		defer relay.close()
+		ctx = progress.WithReporter(ctx, relay)
+	}
+	if !p.ParallelRequests || len(payloads.Requests) < 2 {
+		for i, request := range payloads.Requests {
+			// Once the task is aborted or the runner shuts down, the remaining requests are answered without running
+			if err := p.processRequest(ctx, delegateID, delegateName, rv, payloads.Timeout(i), request); err != nil {
+				return err
+			}
+		}
+	} else if err := p.processParallel(ctx, delegateID, delegateName, rv, payloads); err != nil {
+		return err
+	}
+	// The task is done once every request of the payload is answered
+	p.setLease(ctx, taskID, lease.StateResponded)
+	return nil
+}
+
+// processParallel runs the requests of a payload concurrently. The first request runs on the worker's
+// slot, the others run on free slots of the runner if there are any, else they wait for a previous request.
+func (p *Poller) processParallel(ctx context.Context, delegateID, delegateName string, rv client.RunnerEvent, payloads *client.RunnerAcquiredTasks) error {
+	slots := make(chan struct{}, len(payloads.Requests))
+	slots <- struct{}{}
+	class := p.priorities.classOf(rv.TaskType)
+	acquired := 0
+	defer func() {
+		for ; acquired > 0; acquired-- {
+			p.capacity.release(class)
+		}
+	}()
+
+	var g errgroup.Group
+	for i, request := range payloads.Requests {
+		select {
+		case <-slots:
+		default:
+			if p.capacity.tryAcquire(class) {
+				acquired++
 			} else {
+				<-slots
+			}
+		}
+		timeout := payloads.Timeout(i)
+		g.Go(func() error {
+			defer func() { slots <- struct{}{} }()
+			return p.processRequest(ctx, delegateID, delegateName, rv, timeout, request)
+		})
+	}
+	return g.Wait()
+}
+
+// processRequest executes one request of a task and sends its response
+func (p *Poller) processRequest(ctx context.Context, delegateID, delegateName string, rv client.RunnerEvent, timeout time.Duration, request *task.Request) error {
+	p.Metrics.IncrementTaskRunningCount(rv.AccountID, rv.TaskType, delegateName)
+	defer p.Metrics.DecrementTaskRunningCount(rv.AccountID, rv.TaskType, delegateName)
+	p.running.add(rv.TaskType, 1)
+	defer p.running.add(rv.TaskType, -1)
+	start_time := time.Now()
+
+	// TODO set the task id in runner request translator
+	// task id is required by the lite engine to send the response to the manager for hosted builds
+	request.Task.ID = rv.TaskID
+	if p.RequestFilter != nil {
+		if err := p.RequestFilter(rv.AccountID, request.Task.Type, rv.RunnerType); err != nil {
+			logger.WithError(ctx, err).WithField("task_type", request.Task.Type).Warnln("Request rejected by the filter rules, sending failed status")
+			p.Metrics.IncrementTaskRejectedCount(rv.AccountID, request.Task.Type, delegateName)
+			taskResponse := &client.TaskResponse{ID: rv.TaskID, Type: request.Task.Type}
+			if err := setFailure(taskResponse, errors.Wrap(ErrRequestRejected, err.Error())); err != nil {
 				return err
 			}
-		} else {
-			taskResponse.Code = client.StatusCodeSuccess
-			taskResponse.Data = resp.Body()
+			return p.respond(ctx, taskResponse)
 		}
-		if err := p.Client.SendStatus(ctx, delegateID, rv.TaskID, taskResponse); err != nil {
+	}
+	if timeout == 0 {
+		timeout = p.Timeouts.For(request.Task.Type)
+	}
+	resp, interrupted := p.execute(ctx, request, timeout)
+	p.Metrics.SetTaskExecutionTime(rv.AccountID, rv.TaskType, rv.TaskID, delegateName, metricsutils.CalculateDuration(start_time))
+	taskResponse := &client.TaskResponse{ID: rv.TaskID, Type: request.Task.Type}
+	if errors.Is(interrupted, ErrTaskAborted) {
+		logger.Infoln(ctx, "Task was aborted, sending aborted status")
+		taskResponse.Code = client.StatusCodeAborted
+		taskResponse.Error = ErrTaskAborted.Error()
+		// Use a fresh context, the task's context is already cancelled
+		return p.respond(context.WithoutCancel(ctx), taskResponse)
+	}
+	if errors.Is(interrupted, ErrRunnerShuttingDown) {
+		logger.Warnln(ctx, "Task did not complete before the runner shut down, sending failed status")
+		p.Metrics.IncrementTaskFailedCount(rv.AccountID, rv.TaskType, delegateName)
+		if err := setFailure(taskResponse, ErrRunnerShuttingDown); err != nil {
 			return err
 		}
+		return p.respond(context.WithoutCancel(ctx), taskResponse)
+	}
+	if errors.Is(interrupted, ErrTaskTimedOut) {
+		logger.WithField(ctx, "timeout", timeout).Errorln("Task timed out")
+		p.Metrics.IncrementTaskTimeoutCount(rv.AccountID, rv.TaskType, delegateName)
+		p.Metrics.IncrementTaskFailedCount(rv.AccountID, rv.TaskType, delegateName)
+		if err := setFailure(taskResponse, errors.Wrapf(ErrTaskTimedOut, "timeout of %s exceeded", timeout)); err != nil {
+			return err
+		}
+		taskResponse.ErrorCode = client.ErrorCodeTimeout
+		return p.respond(ctx, taskResponse)
+	}
+	if resp == nil {
+		return nil
+	}
+	p.Metrics.IncrementTaskCompletedCount(rv.AccountID, rv.TaskType, delegateName)
+
+	if resp.Error() != nil {
+		logger.WithError(ctx, resp.Error()).Error("Process task failed")
+		p.Metrics.IncrementTaskFailedCount(rv.AccountID, rv.TaskType, delegateName)
+		if err := setFailure(taskResponse, resp.Error()); err != nil {
+			return err
+		}
+	} else {
+		taskResponse.Code = client.StatusCodeSuccess
+		taskResponse.Data = resp.Body()
+	}
+	return p.respond(ctx, taskResponse)
+}
+
+// execute routes the request to its handler, with a deadline if timeout is set. If the task's context
+// gets cancelled or the deadline passes before the handler returns, the worker is released right away
+// and the handler is left to tear down its own resources. The cancellation cause is returned in that case.
+// The handler is not started at all if the task's context is already cancelled.
+func (p *Poller) execute(ctx context.Context, request *task.Request, timeout time.Duration) (task.Response, error) {
+	if cause := context.Cause(ctx); cause != nil {
+		return task.Error(cause), cause
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, ErrTaskTimedOut)
+		defer cancel()
+	}
+	done := make(chan task.Response, 1)
+	go func() {
+		done <- p.router.Handle(ctx, request)
+	}()
+	select {
+	case resp := <-done:
+		// The handler may have returned because of the cancellation
+		return resp, context.Cause(ctx)
+	case <-ctx.Done():
+		return task.Error(context.Cause(ctx)), context.Cause(ctx)
+	}
+}
+
+// respond sends the response of a request to the manager and records the outcome in the journal. The lease
+// of the task is left to the caller, a task with several requests sends several responses.
+func (p *Poller) respond(ctx context.Context, taskResponse *client.TaskResponse) error {
+	if err := p.Journal.Finish(taskResponse.ID, string(taskResponse.Code), taskResponse.Error, len(taskResponse.Data)); err != nil {
+		logger.WithError(ctx, err).Warnln("could not record task outcome in the journal")
 	}
+	return p.Outbox.Send(ctx, taskResponse.ID, taskResponse)
+}
+
+// beginJournal records the task in the journal. A failure is logged, it must not stop the task.
+func (p *Poller) beginJournal(ctx context.Context, rv client.RunnerEvent) {
+	if err := p.Journal.Begin(rv.TaskID, rv.TaskType, rv.AccountID); err != nil {
+		logger.WithError(ctx, err).Warnln("could not record task in the journal")
+	}
+}
+
+// setLease records the progress of a task. A failure is logged, it must not stop the task.
+func (p *Poller) setLease(ctx context.Context, taskID string, state lease.State) {
+	if err := p.Leases.Set(taskID, state); err != nil {
+		logger.WithError(ctx, err).WithField("state", state).Warnln("could not record task lease")
+	}
+}
+
+// setFailure marks the task response as failed with the given error
+func setFailure(taskResponse *client.TaskResponse, err error) error {
+	taskResponse.Code = client.StatusCodeFailed
+	taskResponse.Error = err.Error()
+	// TODO: a bug here. If the Data is nil, exception happen in cg manager.
+	// This will be taken care after integrating with new response workflow
+	respBytes, err := json.Marshal(&api.VMTaskExecutionResponse{ErrorMessage: taskResponse.Error})
+	if err != nil {
+		return err
+	}
+	taskResponse.Data = respBytes
 	return nil
 }
 
-func (p *Poller) Shutdown(ctx context.Context) {
+// abort cancels the context of an in-flight task. Tasks which are not running on this runner are ignored.
+func (p *Poller) abort(ctx context.Context, taskID string) {
+	v, ok := p.m.Load(taskID)
+	if !ok {
+		logger.WithField(ctx, "task_id", taskID).Infoln("Received abort for a task which is not running on this runner")
+		return
+	}
+	logger.WithField(ctx, "task_id", taskID).Infoln("Aborting task")
+	v.(context.CancelCauseFunc)(ErrTaskAborted)
+}
+
+// Shutdown stops acquiring new tasks and waits for the in progress tasks to complete. If they do not complete
+// within drainTimeout, they are cancelled and reported as failed. A zero drainTimeout waits indefinitely.
+// It returns a report of what happened to the in progress tasks.
+func (p *Poller) Shutdown(ctx context.Context, drainTimeout time.Duration) *ShutdownReport {
+	d := newDrain(drainTimeout)
+	p.drain.Store(d)
 	p.stopPollingForTasks()
 	logger.Infoln(ctx, "Notified poller to stop acquiring new tasks, waiting for in progress tasks completion")
-	p.waitForTasks()
-	logger.Infoln(ctx, "All tasks are completed, stopping task processor...")
+	if p.waitForTasks(drainTimeout) {
+		logger.Infoln(ctx, "All tasks are completed, stopping task processor...")
+		return d.finish(nil)
+	}
+
+	logger.Warnf(ctx, "Tasks did not complete within %s, aborting them", drainTimeout)
+	p.aborting.Store(true)
+	p.m.Range(func(k, v any) bool {
+		d.cancel(k.(string))
+		v.(context.CancelCauseFunc)(ErrRunnerShuttingDown)
+		return true
+	})
+	if p.waitForTasks(abortGracePeriod) {
+		logger.Infoln(ctx, "All tasks are aborted, stopping task processor...")
+		return d.finish(nil)
+	}
+	var running []string
+	p.m.Range(func(k, _ any) bool {
+		running = append(running, k.(string))
+		return true
+	})
+	logger.WithField(ctx, "tasks", running).Errorln("Tasks did not report their failure in time, leaving them behind")
+	return d.finish(running)
 }
 
 func (p *Poller) stopPollingForTasks() {
 	close(p.stopChannel) // Notify poller to stop acquiring new tasks
 }
 
-func (p *Poller) waitForTasks() {
-	<-p.doneChannel // Wait for all tasks to be processed
+// waitForTasks waits for all tasks to be processed, for up to timeout if set.
+// It returns false if the tasks did not complete in time.
+func (p *Poller) waitForTasks(timeout time.Duration) bool {
+	if timeout <= 0 {
+		<-p.doneChannel
+		return true
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-p.doneChannel:
+		return true
+	case <-timer.C:
+		return false
+	}
 }
@@ -0,0 +1,57 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package poller
+
+import (
+	"regexp"
+
+	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/delegateshell/filter"
+)
+
+// Name of the class of the task types which match no priority class
+const defaultPriorityClass = "default"
+
+// priorities maps the task types to their priority class. Classes are numbered in priority order,
+// a lower number is served first. The default class is the last one.
+type priorities struct {
+	names    []string
+	patterns [][]*regexp.Regexp
+	reserved []int
+}
+
+func newPriorities(classes delegate.PriorityClasses) *priorities {
+	p := &priorities{}
+	for _, class := range classes {
+		var patterns []*regexp.Regexp
+		for _, taskType := range class.TaskTypes {
+			patterns = append(patterns, filter.Glob(taskType))
+		}
+		p.names = append(p.names, class.Name)
+		p.patterns = append(p.patterns, patterns)
+		p.reserved = append(p.reserved, class.Reserved)
+	}
+	p.names = append(p.names, defaultPriorityClass)
+	p.patterns = append(p.patterns, nil)
+	p.reserved = append(p.reserved, 0)
+	return p
+}
+
+// classOf returns the class of a task type, the first class matching it
+func (p *priorities) classOf(taskType string) int {
+	for class, patterns := range p.patterns {
+		for _, pattern := range patterns {
+			if pattern.MatchString(taskType) {
+				return class
+			}
+		}
+	}
+	return len(p.names) - 1
+}
+
+func (p *priorities) name(class int) string {
+	return p.names[class]
+}
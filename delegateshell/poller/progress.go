@@ -0,0 +1,103 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package poller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/delegateshell/progress"
+	"github.com/harness/runner/logger"
+)
+
+// Time given to the manager to take a progress event
+var progressTimeout = 10 * time.Second
+
+// progressRelay sends the progress events of a task to the manager, at most once per interval.
+// Once the task reported progress, its last event is sent again every interval for as long as
+// the task runs, as a sign that the task is alive.
+type progressRelay struct {
+	ctx        context.Context
+	client     client.Client
+	delegateID string
+	taskID     string
+	interval   time.Duration
+
+	mu      sync.Mutex
+	last    *client.TaskProgress
+	started bool
+	stopped bool
+	stop    chan struct{}
+}
+
+func newProgressRelay(ctx context.Context, c client.Client, delegateID, taskID string, interval time.Duration) *progressRelay {
+	return &progressRelay{
+		ctx:        ctx,
+		client:     c,
+		delegateID: delegateID,
+		taskID:     taskID,
+		interval:   interval,
+		stop:       make(chan struct{}),
+	}
+}
+
+// Report records the latest progress of the task, it's sent on the next tick of the relay
+func (r *progressRelay) Report(e progress.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return
+	}
+	r.last = &client.TaskProgress{
+		ID:         r.taskID,
+		Phase:      e.Phase,
+		Percentage: e.Percentage,
+		Message:    e.Message,
+		Timestamp:  e.Time.UnixMilli(),
+	}
+	if !r.started {
+		r.started = true
+		go r.run()
+	}
+}
+
+// close stops relaying, the task is complete
+func (r *progressRelay) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.stop)
+	}
+}
+
+func (r *progressRelay) run() {
+	// The first event is sent right away
+	r.send()
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.send()
+		}
+	}
+}
+
+func (r *progressRelay) send() {
+	r.mu.Lock()
+	last := *r.last
+	r.mu.Unlock()
+	ctx, cancel := context.WithTimeout(r.ctx, progressTimeout)
+	defer cancel()
+	if err := r.client.SendProgress(ctx, r.delegateID, r.taskID, &last); err != nil {
+		logger.WithError(r.ctx, err).Warnln("could not send task progress")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package poller
+
+import (
+	"context"
+	"sync"
+)
+
+// registration holds the ID the runner events are polled with. Polling is paused while the runner registers
+// again with the manager, and resumes with the ID of the new registration.
+type registration struct {
+	mu sync.Mutex
+	id string
+	// closed once polling resumes, nil while polling is not paused
+	resumed chan struct{}
+	// cancels the poll in progress
+	cancel context.CancelFunc
+}
+
+// poll waits until polling is not paused. It returns the runner ID and the context of the next poll, which is
+// cancelled if polling is paused in the meantime.
+func (r *registration) poll(ctx context.Context) (context.Context, context.CancelFunc, string, error) {
+	for {
+		r.mu.Lock()
+		resumed := r.resumed
+		if resumed == nil {
+			pollCtx, cancel := context.WithCancel(ctx)
+			r.cancel = cancel
+			id := r.id
+			r.mu.Unlock()
+			return pollCtx, cancel, id, nil
+		}
+		r.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, nil, "", ctx.Err()
+		case <-resumed:
+		}
+	}
+}
+
+func (r *registration) pause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.resumed == nil {
+		r.resumed = make(chan struct{})
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+}
+
+func (r *registration) resume(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.id = id
+	if r.resumed != nil {
+		close(r.resumed)
+		r.resumed = nil
+	}
+}
+
+// current returns the ID the runner is registered with
+func (r *registration) current() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.id
+}
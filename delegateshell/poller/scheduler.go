@@ -0,0 +1,212 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package poller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/delegateshell/delegate"
+)
+
+// queued is an event waiting for a worker
+type queued struct {
+	event    *client.RunnerEvent
+	class    int
+	queuedAt time.Time
+}
+
+// queue holds the events of one account in one priority class, or of one task type of an account
+type queue struct {
+	accountID string
+	class     int
+	weight    int
+	events    []*queued
+	running   int
+}
+
+// share is the load of the queue relative to its weight. The queue with the lowest share is served first.
+func (q *queue) share() float64 {
+	return float64(q.running+len(q.events)) / float64(q.weight)
+}
+
+// scheduler decides which events the runner takes up, so that an account flooding the runner with
+// events cannot starve the other accounts. Events are grouped in queues by priority class and account,
+// and optionally by task type. An event is only taken up if a slot is free for it, so the queues hardly
+// ever hold waiting events: the weights apply when a batch of events is offered, the free slots go to the
+// classes in priority order, and within a class to the queues with the lowest share of running tasks
+// relative to their weight. Accounts can also be capped to a maximum number of tasks running at the same time.
+type scheduler struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	config     delegate.SchedulingConfig
+	priorities *priorities
+	queues     map[string]*queue
+	// number of events queued or running by account, used to enforce the max concurrency
+	active map[string]int
+	closed bool
+}
+
+func newScheduler(config delegate.SchedulingConfig, priorities *priorities) *scheduler {
+	s := &scheduler{
+		config:     config,
+		priorities: priorities,
+		queues:     map[string]*queue{},
+		active:     map[string]int{},
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *scheduler) key(e *client.RunnerEvent) string {
+	class := s.priorities.classOf(e.TaskType)
+	if s.config.GroupByTaskType {
+		return fmt.Sprintf("%d/%s/%s", class, e.AccountID, e.TaskType)
+	}
+	return fmt.Sprintf("%d/%s", class, e.AccountID)
+}
+
+// offer queues a batch of events in priority then fair-share order, for as long as acquire reserves
+// a slot for them in their class. This is where the weights apply: each free slot goes to the group of
+// events whose queue has the lowest share, counting the tasks it already runs. Events of accounts which
+// reached their max concurrency are not queued. It returns the events which were not queued, they are
+// left for other runners.
+func (s *scheduler) offer(events []*client.RunnerEvent, acquire func(class int) bool) []*client.RunnerEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := map[string][]*client.RunnerEvent{}
+	var keys []string
+	for _, e := range events {
+		k := s.key(e)
+		if _, ok := pending[k]; !ok {
+			keys = append(keys, k)
+		}
+		pending[k] = append(pending[k], e)
+	}
+
+	var skipped []*client.RunnerEvent
+	for len(pending) > 0 {
+		// Pick the group of the highest priority class with the lowest share, dropping the ones of accounts at their cap
+		var next string
+		var nextClass int
+		var nextShare float64
+		for _, k := range keys {
+			group, ok := pending[k]
+			if !ok {
+				continue
+			}
+			accountID := group[0].AccountID
+			if limit := s.config.MaxConcurrencyOf(accountID); limit > 0 && s.active[accountID] >= limit {
+				skipped = append(skipped, group...)
+				delete(pending, k)
+				continue
+			}
+			q := s.queue(k, accountID, group[0].TaskType)
+			if share := q.share(); next == "" || q.class < nextClass || (q.class == nextClass && share < nextShare) {
+				next, nextClass, nextShare = k, q.class, share
+			}
+		}
+		if next == "" {
+			break
+		}
+		group := pending[next]
+		q := s.queues[next]
+		if !acquire(q.class) {
+			// The class is full, the groups of other classes may still have room
+			skipped = append(skipped, group...)
+			delete(pending, next)
+			continue
+		}
+		q.events = append(q.events, &queued{event: group[0], class: q.class, queuedAt: time.Now()})
+		s.active[q.accountID]++
+		if len(group) == 1 {
+			delete(pending, next)
+		} else {
+			pending[next] = group[1:]
+		}
+		s.cond.Signal()
+	}
+	s.prune()
+	return skipped
+}
+
+// next blocks until an event is available and returns it. The events were given a slot when they were
+// offered, so they are taken in priority order only to start the most urgent ones first. It returns false
+// once the scheduler is closed and all the queued events are served.
+func (s *scheduler) next() (*queued, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		var next *queue
+		for _, q := range s.queues {
+			if len(q.events) == 0 {
+				continue
+			}
+			if next == nil || q.class < next.class ||
+				(q.class == next.class && float64(q.running)/float64(q.weight) < float64(next.running)/float64(next.weight)) {
+				next = q
+			}
+		}
+		if next != nil {
+			item := next.events[0]
+			next.events = next.events[1:]
+			next.running++
+			return item, true
+		}
+		if s.closed {
+			return nil, false
+		}
+		s.cond.Wait()
+	}
+}
+
+// done marks an event returned by next as served
+func (s *scheduler) done(e *client.RunnerEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.queues[s.key(e)]; ok && q.running > 0 {
+		q.running--
+	}
+	if s.active[e.AccountID] > 0 {
+		s.active[e.AccountID]--
+	}
+	s.prune()
+}
+
+// close wakes up the workers waiting for events, they stop once the queued events are served
+func (s *scheduler) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cond.Broadcast()
+}
+
+// queue returns the queue for a key, creating it if needed. Must be called with the lock held.
+func (s *scheduler) queue(k, accountID, taskType string) *queue {
+	q, ok := s.queues[k]
+	if !ok {
+		q = &queue{accountID: accountID, class: s.priorities.classOf(taskType), weight: s.config.WeightOf(accountID)}
+		s.queues[k] = q
+	}
+	return q
+}
+
+// prune removes the idle queues. Must be called with the lock held.
+func (s *scheduler) prune() {
+	for k, q := range s.queues {
+		if len(q.events) == 0 && q.running == 0 {
+			delete(s.queues, k)
+		}
+	}
+	for accountID, n := range s.active {
+		if n == 0 {
+			delete(s.active, accountID)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package poller
+
+import (
+	"sync"
+	"time"
+)
+
+// ShutdownReport describes what happened to the tasks which were in progress when the runner shut down.
+type ShutdownReport struct {
+	StartedAt    time.Time `json:"startedAt"`
+	CompletedAt  time.Time `json:"completedAt"`
+	DrainTimeout string    `json:"drainTimeout"`
+	// Tasks which completed before the drain deadline
+	Drained []string `json:"drained"`
+	// Tasks which were cancelled at the drain deadline and reported as failed
+	Aborted []string `json:"aborted"`
+	// Tasks which were still running when the runner gave up on them
+	Orphaned []string `json:"orphaned"`
+}
+
+// drain keeps track of the tasks completing while the poller shuts down
+type drain struct {
+	mu        sync.Mutex
+	report    *ShutdownReport
+	cancelled map[string]bool
+}
+
+func newDrain(drainTimeout time.Duration) *drain {
+	timeout := "none"
+	if drainTimeout > 0 {
+		timeout = drainTimeout.String()
+	}
+	return &drain{
+		report:    &ShutdownReport{StartedAt: time.Now(), DrainTimeout: timeout, Drained: []string{}, Aborted: []string{}, Orphaned: []string{}},
+		cancelled: map[string]bool{},
+	}
+}
+
+// cancel records that the task was cancelled at the drain deadline
+func (d *drain) cancel(taskID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cancelled[taskID] = true
+}
+
+// done records a task which completed during the drain
+func (d *drain) done(taskID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancelled[taskID] {
+		d.report.Aborted = append(d.report.Aborted, taskID)
+	} else {
+		d.report.Drained = append(d.report.Drained, taskID)
+	}
+}
+
+// finish completes the report with the tasks which are still running
+func (d *drain) finish(running []string) *ShutdownReport {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.report.Orphaned = append(d.report.Orphaned, running...)
+	d.report.CompletedAt = time.Now()
+	// Tasks left behind may still complete later, the returned report must not change under the caller
+	report := *d.report
+	return &report
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package poller
+
+import (
+	"context"
+	"time"
+
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/logger"
+)
+
+// EventSource delivers the runner events of the task server to the poller.
+type EventSource interface {
+	// Next blocks until runner events are available and returns them, the batch may be empty.
+	// It only fails once ctx is done.
+	Next(ctx context.Context, runnerID string) ([]*client.RunnerEvent, error)
+	// Skipped tells the source that the runner could not take some of the events, because it was full
+	Skipped()
+}
+
+// pollSource polls the runner events endpoint. The wait between two polls adapts to the outcome of the
+// previous poll. While the runner is at full capacity it keeps polling, but only the abort events are returned.
+type pollSource struct {
+	client   client.Client
+	interval *pollInterval
+	// tells whether the runner can take more tasks
+	ready func() bool
+	wait  time.Duration
+}
+
+func newPollSource(c client.Client, interval *pollInterval, ready func() bool) *pollSource {
+	return &pollSource{client: c, interval: interval, ready: ready, wait: interval.initial()}
+}
+
+func (s *pollSource) Next(ctx context.Context, runnerID string) ([]*client.RunnerEvent, error) {
+	for {
+		if err := sleep(ctx, s.wait); err != nil {
+			return nil, err
+		}
+		full := !s.ready()
+		events, err := s.fetch(ctx, runnerID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			continue
+		}
+		if full {
+			// Abort signals do not need capacity, the other events are returned again once the runner has capacity
+			s.wait = s.interval.initial()
+			events = abortEvents(events)
+			if len(events) == 0 {
+				logger.Debugln(ctx, "Runner is at full capacity, skipping task events")
+				continue
+			}
+		}
+		return events, nil
+	}
+}
+
+// Skipped does nothing, the skipped events are returned again by the next poll
+func (s *pollSource) Skipped() {}
+
+// fetch polls the runner events once
+func (s *pollSource) fetch(ctx context.Context, runnerID string) ([]*client.RunnerEvent, error) {
+	// A long poll is held open by the manager, so it gets more time to complete
+	taskEventsCtx, cancelFn := context.WithTimeout(ctx, taskEventsTimeout+s.interval.config.LongPoll)
+	tasks, err := s.client.GetRunnerEvents(taskEventsCtx, runnerID)
+	cancelFn()
+	if err != nil {
+		s.wait = s.interval.failed()
+		logger.WithError(ctx, err).Errorf("could not query for task events, retrying in %s", s.wait)
+		return nil, err
+	}
+	s.wait = s.interval.succeeded(len(tasks.RunnerEvents))
+	return tasks.RunnerEvents, nil
+}
+
+// abortEvents returns the abort events of the batch
+func abortEvents(events []*client.RunnerEvent) []*client.RunnerEvent {
+	var aborts []*client.RunnerEvent
+	for _, e := range events {
+		if e.EventType == client.RunnerEventTypeAbort {
+			aborts = append(aborts, e)
+		}
+	}
+	return aborts
+}
+
+// sleep waits for d, it returns the error of ctx if ctx is done first
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package poller
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/logger"
+)
+
+var (
+	// Backoff between two connection attempts of the event stream
+	streamReconnectMin = time.Second
+	streamReconnectMax = time.Minute
+	// Number of pushed batches held while the poller is busy, the stream catches up with a poll beyond that
+	streamBuffer = 16
+)
+
+// streamSource takes the runner events pushed by the manager over a persistent connection. While the
+// connection is down, the runner events are polled instead. Pushed events are not sent again, so the
+// runner also polls right after connecting, every resync period, and once it has capacity again after
+// events had to be dropped.
+type streamSource struct {
+	poll      *pollSource
+	streamer  client.Streamer
+	transport string
+	resync    time.Duration
+	// called when the manager asks for a daemon set reconciliation
+	reconcile func()
+
+	pushed    chan []*client.RunnerEvent
+	runnerID  atomic.Value
+	connected atomic.Bool
+	// set when events may have been missed, the next batch is polled
+	catchUp  atomic.Bool
+	lastPoll time.Time
+
+	mu sync.Mutex
+	// the stream which is connected, if any
+	stream client.EventStream
+}
+
+func newStreamSource(poll *pollSource, streamer client.Streamer, transport string, resync time.Duration, reconcile func()) *streamSource {
+	return &streamSource{
+		poll:      poll,
+		streamer:  streamer,
+		transport: transport,
+		resync:    resync,
+		reconcile: reconcile,
+		pushed:    make(chan []*client.RunnerEvent, streamBuffer),
+	}
+}
+
+// start connects the stream in the background, it's kept connected until ctx is done
+func (s *streamSource) start(ctx context.Context, runnerID string) {
+	s.runnerID.Store(runnerID)
+	go s.run(ctx)
+}
+
+func (s *streamSource) Next(ctx context.Context, runnerID string) ([]*client.RunnerEvent, error) {
+	// The runner registered again, the stream of the previous registration is replaced
+	if previous := s.runnerID.Swap(runnerID); previous != runnerID {
+		s.mu.Lock()
+		if s.stream != nil {
+			s.stream.Close()
+		}
+		s.mu.Unlock()
+	}
+	for {
+		if !s.connected.Load() {
+			events, err := s.poll.Next(ctx, runnerID)
+			s.lastPoll = time.Now()
+			return events, err
+		}
+		if s.resync > 0 && time.Since(s.lastPoll) >= s.resync {
+			s.catchUp.Store(true)
+		}
+		// Catch-up polls are spaced out as the polls are
+		tick := s.poll.interval.initial()
+		if s.catchUp.Load() && s.poll.ready() {
+			next := s.poll.wait - time.Since(s.lastPoll)
+			if next <= 0 {
+				s.catchUp.Store(false)
+				s.lastPoll = time.Now()
+				events, err := s.poll.fetch(ctx, runnerID)
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil, ctx.Err()
+					}
+					// The failure is logged and backed off by the poll, the catch-up is tried again after the wait
+					s.catchUp.Store(true)
+					return nil, err
+				}
+				return events, nil
+			}
+			if next < tick {
+				tick = next
+			}
+		}
+		// The connection state and the capacity are checked again on every tick
+		timer := time.NewTimer(tick)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case events := <-s.pushed:
+			timer.Stop()
+			if s.poll.ready() {
+				return events, nil
+			}
+			// Abort signals do not need capacity, the other events are polled again once the runner has capacity
+			logger.Debugln(ctx, "Runner is at full capacity, dropping pushed task events")
+			s.catchUp.Store(true)
+			if aborts := abortEvents(events); len(aborts) > 0 {
+				return aborts, nil
+			}
+		case <-timer.C:
+		}
+	}
+}
+
+// Skipped makes the source poll for the events the runner could not take, they are not pushed again
+func (s *streamSource) Skipped() {
+	s.catchUp.Store(true)
+}
+
+// run keeps the stream connected until ctx is done
+func (s *streamSource) run(ctx context.Context) {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = streamReconnectMin
+	b.MaxInterval = streamReconnectMax
+	b.MaxElapsedTime = 0
+	for {
+		stream, err := s.streamer.StreamRunnerEvents(ctx, s.runnerID.Load().(string), s.transport)
+		if err == nil {
+			logger.Infof(ctx, "Connected to the %s event stream of the manager", s.transport)
+			s.catchUp.Store(true)
+			s.connected.Store(true)
+			err = s.receive(ctx, stream)
+			s.connected.Store(false)
+			b.Reset()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		wait := b.NextBackOff()
+		logger.WithError(ctx, err).Warnf("%s event stream is down, polling for task events until it reconnects in %s", s.transport, wait)
+		if sleep(ctx, wait) != nil {
+			return
+		}
+	}
+}
+
+// receive hands the messages of the stream over until the stream fails
+func (s *streamSource) receive(ctx context.Context, stream client.EventStream) error {
+	// The stream is closed along with the poller, which fails the pending receive
+	stop := context.AfterFunc(ctx, func() { stream.Close() })
+	defer stop()
+	s.mu.Lock()
+	s.stream = stream
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.stream = nil
+		s.mu.Unlock()
+		stream.Close()
+	}()
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		switch msg.Type {
+		case client.StreamMessageRunnerEvents:
+			select {
+			case s.pushed <- msg.RunnerEvents:
+			default:
+				s.catchUp.Store(true)
+			}
+		case client.StreamMessageReconcile:
+			if s.reconcile != nil {
+				s.reconcile()
+			}
+		case client.StreamMessagePing:
+		default:
+			logger.Debugf(ctx, "ignoring event stream message of unknown type %q", msg.Type)
+		}
+	}
+}
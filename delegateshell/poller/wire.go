@@ -5,6 +5,10 @@ import (
 	"github.com/google/wire"
 	"github.com/harness/runner/delegateshell/client"
 	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/delegateshell/filter"
+	"github.com/harness/runner/delegateshell/journal"
+	"github.com/harness/runner/delegateshell/lease"
+	"github.com/harness/runner/delegateshell/outbox"
 	"github.com/harness/runner/metrics"
 )
 
@@ -16,9 +20,18 @@ var WireSet = wire.NewSet(
 // ProvidePoller is a Wire provider function that creates a Poller.
 func ProvidePoller(
 	client client.Client,
+	outbox *outbox.Outbox,
+	journal *journal.Journal,
+	leases *lease.Store,
 	router *task.Router,
 	config *delegate.Config,
 	metrics metrics.Metrics,
+	rules *filter.Rules,
 ) *Poller {
-	return New(client, router, metrics, config.EnableRemoteLogging)
+	p := New(client, outbox, journal, leases, router, metrics, config.EnableRemoteLogging, config.GetTimeoutConfig(), config.GetCapacityConfig(), config.GetPollingConfig(), config.GetSchedulingConfig())
+	p.SetFilter(rules.RunnerEvent)
+	p.SetRequestFilter(rules.Allow)
+	p.ParallelRequests = config.Task.ParallelRequests
+	p.ProgressInterval = config.Task.ProgressInterval
+	return p
 }
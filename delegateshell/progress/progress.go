@@ -0,0 +1,48 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+// Package progress lets task handlers report the progress of a long-running task.
+// The reporter is set in the request context by the poller, which relays the
+// events to the manager as task-level liveness signals.
+package progress
+
+import (
+	"context"
+	"time"
+)
+
+// Unknown is the percentage of a task whose completion cannot be estimated
+const Unknown = -1
+
+// Event is the progress of a task at a point in time
+type Event struct {
+	Phase string
+	// Percentage of completion, from 0 to 100, or Unknown
+	Percentage int
+	Message    string
+	Time       time.Time
+}
+
+// Reporter receives the progress events of a task
+type Reporter interface {
+	Report(e Event)
+}
+
+type reporterKey struct{}
+
+// WithReporter returns a context carrying the progress reporter of a task
+func WithReporter(ctx context.Context, r Reporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, r)
+}
+
+// Report reports the progress of the task running with the context. It's a no-op
+// if the context has no reporter.
+func Report(ctx context.Context, phase string, percentage int, message string) {
+	r, ok := ctx.Value(reporterKey{}).(Reporter)
+	if !ok {
+		return
+	}
+	r.Report(Event{Phase: phase, Percentage: percentage, Message: message, Time: time.Now()})
+}
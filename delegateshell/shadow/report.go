@@ -0,0 +1,188 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package shadow
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/harness/runner/utils"
+	"github.com/harness/runner/version"
+)
+
+// How the router would run a task type
+const (
+	routeHandler = "handler"
+	routeCGI     = "cgi"
+)
+
+// Verdict on whether the runner can run a task type
+const (
+	VerdictCompatible   = "COMPATIBLE"
+	VerdictIncompatible = "INCOMPATIBLE"
+	// The task type goes to the cgi driver and none of its payloads could be checked
+	VerdictUnverified = "UNVERIFIED"
+	// All the events of the task type were rejected by the filter rules
+	VerdictRejected = "REJECTED"
+)
+
+// Maximum number of distinct issues kept per task type
+const maxIssues = 20
+
+// Report is the compatibility report of a shadow runner.
+type Report struct {
+	Version        string               `json:"version"`
+	Tag            string               `json:"tag"`
+	DecodePayloads bool                 `json:"decodePayloads"`
+	StartedAt      time.Time            `json:"startedAt"`
+	UpdatedAt      time.Time            `json:"updatedAt"`
+	TaskTypes      map[string]*TaskType `json:"taskTypes"`
+}
+
+// TaskType records what the runner would have done with the events of a task type.
+type TaskType struct {
+	Verdict string `json:"verdict"`
+	Route   string `json:"route,omitempty"`
+	// Events the runner would have acquired and executed
+	Events int `json:"events"`
+	// Events the runner would have left to other runners because of the filter rules
+	Rejected int `json:"rejected"`
+	// Payloads decoded, and the ones which could not have run
+	Decoded        int       `json:"decoded"`
+	Incompatible   int       `json:"incompatible"`
+	DecodeFailures int       `json:"decodeFailures"`
+	Issues         []string  `json:"issues,omitempty"`
+	FirstSeen      time.Time `json:"firstSeen"`
+	LastSeen       time.Time `json:"lastSeen"`
+}
+
+type report struct {
+	mu sync.Mutex
+	Report
+}
+
+func newReport(tag string) *report {
+	now := time.Now()
+	return &report{Report: Report{
+		Version:   version.Version,
+		Tag:       tag,
+		StartedAt: now,
+		UpdatedAt: now,
+		TaskTypes: map[string]*TaskType{},
+	}}
+}
+
+// taskType returns the record of a task type, the lock must be held
+func (r *report) taskType(name string) *TaskType {
+	now := time.Now()
+	r.UpdatedAt = now
+	t, ok := r.TaskTypes[name]
+	if !ok {
+		t = &TaskType{FirstSeen: now}
+		r.TaskTypes[name] = t
+	}
+	t.LastSeen = now
+	return t
+}
+
+func (r *report) rejected(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.taskType(name).Rejected++
+}
+
+func (r *report) observed(name, route string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.taskType(name)
+	t.Events++
+	t.Route = route
+}
+
+func (r *report) decoded(name string, issues []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.taskType(name)
+	t.Decoded++
+	if len(issues) > 0 {
+		t.Incompatible++
+		t.addIssues(issues...)
+	}
+}
+
+func (r *report) failed(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.taskType(name)
+	t.DecodeFailures++
+	t.addIssues("could not read payload: " + err.Error())
+}
+
+func (t *TaskType) addIssues(issues ...string) {
+	for _, issue := range issues {
+		if len(t.Issues) >= maxIssues {
+			return
+		}
+		known := false
+		for _, i := range t.Issues {
+			known = known || i == issue
+		}
+		if !known {
+			t.Issues = append(t.Issues, issue)
+		}
+	}
+}
+
+func (t *TaskType) verdict() string {
+	switch {
+	case t.Incompatible > 0:
+		return VerdictIncompatible
+	case t.Events == 0 && t.Rejected > 0:
+		return VerdictRejected
+	case t.Route == routeHandler || t.Decoded > 0:
+		return VerdictCompatible
+	default:
+		return VerdictUnverified
+	}
+}
+
+// Report returns a copy of the compatibility report
+func (s *Shadow) Report() *Report {
+	s.report.mu.Lock()
+	defer s.report.mu.Unlock()
+	r := s.report.Report
+	r.TaskTypes = make(map[string]*TaskType, len(s.report.TaskTypes))
+	for name, t := range s.report.TaskTypes {
+		c := *t
+		c.Issues = append([]string(nil), t.Issues...)
+		c.Verdict = t.verdict()
+		r.TaskTypes[name] = &c
+	}
+	return &r
+}
+
+// Write writes the compatibility report to its file
+func (s *Shadow) Write() error {
+	b, err := json.MarshalIndent(s.Report(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(s.path, b)
+}
+
+// Handle registers the compatibility report endpoint on the default mux
+func (s *Shadow) Handle(endpoint string) {
+	http.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.Report())
+	})
+}
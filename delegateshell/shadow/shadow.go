@@ -0,0 +1,186 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package shadow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/drone/go-task/task"
+	"github.com/drone/go-task/task/drivers/cgi"
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/logger"
+)
+
+var (
+	// Time period between two writes of the compatibility report
+	reportInterval = 1 * time.Minute
+	// Payloads decoded at the same time, the others are not decoded
+	maxDecodes      = 10
+	payloadsTimeout = 30 * time.Second
+	// A pending task is sent with every poll until a runner takes it, it's only observed once in this period
+	seenTTL = 1 * time.Hour
+)
+
+// RouteFn tells whether the runner has a dedicated handler for a task type
+type RouteFn func(taskType string) bool
+
+// Shadow observes the task events sent to the runner and records what the runner would have done with them,
+// without ever acquiring, executing or responding to a task. The result is a compatibility report by task type.
+type Shadow struct {
+	// Set if the client has read-only access to the task payloads and decoding them is enabled
+	Payloads client.PayloadReader
+	Routed   RouteFn
+	report   *report
+	path     string
+	decodes  chan struct{}
+
+	mu sync.Mutex
+	// IDs of the tasks observed, with the time they were first observed at
+	seen map[string]time.Time
+}
+
+func New(c client.Client, routed RouteFn, decodePayloads bool, tag, path string) *Shadow {
+	s := &Shadow{
+		Routed:  routed,
+		report:  newReport(tag),
+		path:    path,
+		decodes: make(chan struct{}, maxDecodes),
+		seen:    map[string]time.Time{},
+	}
+	if r, ok := c.(client.PayloadReader); ok && decodePayloads {
+		s.Payloads = r
+	} else if decodePayloads {
+		logger.Warnln(context.Background(), "Shadow: the task server gives no read-only access to the task payloads, they are not decoded")
+	}
+	s.report.DecodePayloads = s.Payloads != nil
+	return s
+}
+
+// Start writes the compatibility report periodically, until the context is cancelled.
+func (s *Shadow) Start(ctx context.Context) error {
+	logger.WithField(ctx, "decode_payloads", s.Payloads != nil).
+		Warnln("Runner is in shadow mode, tasks are observed but never acquired or executed")
+	go func() {
+		ticker := time.NewTicker(reportInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Infoln(ctx, "context canceled, stopping shadow report")
+				return
+			case <-ticker.C:
+				s.forget()
+				if err := s.Write(); err != nil {
+					logger.WithError(ctx, err).Errorln("could not write shadow report")
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Observe records what the runner would have done with a task event. It's a poller observer.
+// A task is counted and decoded once, however many polls return it.
+func (s *Shadow) Observe(ctx context.Context, e *client.RunnerEvent, allowed bool) {
+	if !s.firstSeen(e.TaskID) {
+		return
+	}
+	ctx = logger.AddLogLabelsToContext(ctx, map[string]string{"task_id": e.TaskID})
+	log := logger.WithFields(ctx, map[string]interface{}{"account_id": e.AccountID, "task_type": e.TaskType})
+	if !allowed {
+		s.report.rejected(e.TaskType)
+		log.Infoln("Shadow: task would be rejected by the filter rules")
+		return
+	}
+	route := routeCGI
+	if s.Routed(e.TaskType) {
+		route = routeHandler
+	}
+	s.report.observed(e.TaskType, route)
+	log.WithField("route", route).Infoln("Shadow: task would be acquired and executed")
+	if s.Payloads == nil {
+		return
+	}
+	select {
+	case s.decodes <- struct{}{}:
+	default:
+		log.Debugln("Shadow: too many payloads being decoded, skipping the payload")
+		return
+	}
+	go func() {
+		defer func() { <-s.decodes }()
+		s.decode(context.WithoutCancel(ctx), e)
+	}()
+}
+
+// firstSeen tells whether the task is observed for the first time, and remembers it
+func (s *Shadow) firstSeen(taskID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if at, ok := s.seen[taskID]; ok && time.Since(at) <= seenTTL {
+		return false
+	}
+	s.seen[taskID] = time.Now()
+	return true
+}
+
+// forget drops the tasks observed longer than seenTTL ago
+func (s *Shadow) forget() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for taskID, at := range s.seen {
+		if time.Since(at) > seenTTL {
+			delete(s.seen, taskID)
+		}
+	}
+}
+
+// decode reads the payload of a task and checks that the runner can run each of its requests
+func (s *Shadow) decode(ctx context.Context, e *client.RunnerEvent) {
+	ctx, cancel := context.WithTimeout(ctx, payloadsTimeout)
+	defer cancel()
+	payloads, err := s.Payloads.ReadExecutionPayload(ctx, e.TaskID)
+	if err != nil {
+		logger.WithError(ctx, err).Warnln("Shadow: could not read task payload")
+		s.report.failed(e.TaskType, err)
+		return
+	}
+	var issues []string
+	for _, request := range payloads.Requests {
+		if request == nil || request.Task == nil {
+			issues = append(issues, "request without a task")
+			continue
+		}
+		issues = append(issues, s.check(request.Task)...)
+		for _, subtask := range request.Tasks {
+			issues = append(issues, s.check(subtask)...)
+		}
+	}
+	if len(issues) > 0 {
+		logger.WithField(ctx, "issues", issues).Warnln("Shadow: task could not run on this runner")
+	}
+	s.report.decoded(e.TaskType, issues)
+}
+
+// check returns the reasons why the runner could not run a task, the way the router would route it
+func (s *Shadow) check(t *task.Task) []string {
+	if s.Routed(t.Type) {
+		return nil
+	}
+	// Task types without a handler go to the cgi driver, which needs an executable or a repository to build
+	conf := new(cgi.Config)
+	if err := json.Unmarshal(t.Config, conf); err != nil {
+		return []string{fmt.Sprintf("no handler for task type %s and its cgi config cannot be decoded: %s", t.Type, err)}
+	}
+	if conf.ExecutableConfig == nil && conf.Repository == nil {
+		return []string{fmt.Sprintf("no handler for task type %s and no cgi executable or repository in its config", t.Type)}
+	}
+	return nil
+}
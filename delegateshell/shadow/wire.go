@@ -0,0 +1,29 @@
+package shadow
+
+import (
+	"path/filepath"
+
+	"github.com/google/wire"
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/router"
+)
+
+// WireSet is a Wire provider set that provides a Shadow.
+var WireSet = wire.NewSet(
+	ProvideShadow,
+)
+
+// ProvideShadow is a Wire provider function that creates a Shadow.
+func ProvideShadow(
+	config *delegate.Config,
+	managerClient client.Client,
+) *Shadow {
+	return New(
+		managerClient,
+		router.HasHandler,
+		config.Shadow.DecodePayloads,
+		config.Shadow.Tag,
+		filepath.Join(config.CacheLocation, "shadow-report.json"),
+	)
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package standalone
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/harness/runner/logger"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Limit of the size of a submitted task
+	maxRequestSize    = 10 << 20
+	readHeaderTimeout = 10 * time.Second
+)
+
+// Serve serves the task endpoints on bind, a TCP address or a unix socket given as unix:///path/to/socket,
+// until ctx is done: POST <endpoint> submits a task request, GET <endpoint> lists the tasks, filtered by the
+// state query parameter, and GET <endpoint>/<task id> returns a task along with its responses.
+// If token is set, the requests must carry it as a bearer token.
+func (s *Server) Serve(ctx context.Context, bind, endpoint, token string) error {
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	mux := http.NewServeMux()
+	mux.HandleFunc(endpoint, s.handleTasks)
+	mux.HandleFunc(endpoint+"/", func(w http.ResponseWriter, r *http.Request) {
+		taskID := strings.TrimPrefix(r.URL.Path, endpoint+"/")
+		if taskID == "" {
+			s.handleTasks(w, r)
+			return
+		}
+		s.handleGet(w, r, taskID)
+	})
+	var handler http.Handler = mux
+	if token != "" {
+		handler = requireToken(token, mux)
+	}
+
+	l, err := listen(bind)
+	if err != nil {
+		return errors.Wrapf(err, "could not listen on %s for the standalone task API", bind)
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: readHeaderTimeout}
+	stop := context.AfterFunc(ctx, func() {
+		srv.Shutdown(context.Background()) // nolint: errcheck
+	})
+	defer stop()
+	logger.Infof(ctx, "Serving the standalone task API on %s%s", bind, endpoint)
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// listen opens the listener of the task API. A unix socket is only accessible to the user running the runner.
+func listen(bind string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(bind, "unix://")
+	if !ok {
+		return net.Listen("tcp", bind)
+	}
+	// A socket left over by a previous run would fail the listener
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// requireToken rejects the requests which do not carry the token as a bearer token
+func requireToken(token string, next http.Handler) http.Handler {
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.List(r.URL.Query().Get("state")))
+	case http.MethodPost:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		t, err := s.Submit(data, "api")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusCreated, t)
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleGet(w http.ResponseWriter, r *http.Request, taskID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	t, err := s.Get(taskID)
+	if err == ErrNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
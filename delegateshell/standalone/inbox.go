@@ -0,0 +1,79 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package standalone
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/harness/runner/logger"
+	"github.com/pkg/errors"
+)
+
+var (
+	// Interval at which the inbox directory is scanned for new task files
+	inboxInterval = 2 * time.Second
+
+	submittedDir = "submitted"
+	failedDir    = "failed"
+)
+
+// watch submits the task files dropped in the inbox directory. Submitted files are moved to
+// the submitted directory of the inbox, files which are not valid tasks to the failed directory.
+func (s *Server) watch(ctx context.Context) error {
+	for _, dir := range []string{s.inbox, filepath.Join(s.inbox, submittedDir), filepath.Join(s.inbox, failedDir)} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return errors.Wrap(err, "could not create standalone inbox directory")
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(inboxInterval)
+		defer ticker.Stop()
+		for {
+			s.scan(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *Server) scan(ctx context.Context) {
+	files, err := os.ReadDir(s.inbox)
+	if err != nil {
+		logger.WithError(ctx, err).Errorln("could not read the standalone inbox directory")
+		return
+	}
+	for _, f := range files {
+		// Files are expected to be written elsewhere and moved in the inbox, partial files are skipped
+		if f.IsDir() || !strings.HasSuffix(f.Name(), fileExt) || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(s.inbox, f.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			logger.WithError(ctx, err).WithField("file", path).Errorln("could not read task file")
+			continue
+		}
+		dest := submittedDir
+		t, err := s.Submit(data, "file:"+f.Name())
+		if err != nil {
+			logger.WithError(ctx, err).WithField("file", path).Errorln("could not submit task file")
+			dest = failedDir
+		} else {
+			logger.WithField(ctx, "file", path).WithField("task_id", t.ID).Infoln("submitted task file")
+		}
+		if err := os.Rename(path, filepath.Join(s.inbox, dest, f.Name())); err != nil {
+			logger.WithError(ctx, err).WithField("file", path).Errorln("could not move task file out of the inbox")
+		}
+	}
+}
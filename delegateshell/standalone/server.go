@@ -0,0 +1,380 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+// Package standalone provides an in-process task server, so that the runner can execute
+// tasks without a Harness manager. Tasks are submitted over a local REST API or as files
+// dropped in an inbox directory, and their results are kept on disk.
+package standalone
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drone/go-task/task"
+	"github.com/google/uuid"
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/logger"
+	"github.com/harness/runner/utils"
+	"github.com/pkg/errors"
+)
+
+// State is the progress of a task submitted to the standalone server.
+type State string
+
+// State enumeration. A completed task takes the status code of its last response.
+const (
+	StateQueued  State = "QUEUED"
+	StateRunning State = "RUNNING"
+)
+
+const fileExt = ".json"
+
+var (
+	// ErrNotFound is returned when the server has no task with the given ID
+	ErrNotFound = errors.New("task not found")
+
+	errNotSupported = errors.New("not supported in standalone mode")
+)
+
+// Task is a task submitted to the standalone server, along with its outcome
+type Task struct {
+	ID          string                 `json:"id"`
+	Type        string                 `json:"type"`
+	AccountID   string                 `json:"accountId"`
+	Source      string                 `json:"source"`
+	State       State                  `json:"state"`
+	Request     *task.Request          `json:"request"`
+	Timeout     time.Duration          `json:"timeout,omitempty"`
+	SubmittedAt time.Time              `json:"submittedAt"`
+	StartedAt   *time.Time             `json:"startedAt,omitempty"`
+	EndedAt     *time.Time             `json:"endedAt,omitempty"`
+	Progress    *client.TaskProgress   `json:"progress,omitempty"`
+	Responses   []*client.TaskResponse `json:"responses,omitempty"`
+}
+
+// Server is an in-process implementation of client.Client backed by a local queue.
+// The tasks and their results are persisted in dir, one file per task.
+type Server struct {
+	dir       string
+	inbox     string
+	accountID string
+
+	mu    sync.Mutex
+	tasks map[string]*Task
+}
+
+var _ client.Client = (*Server)(nil)
+var _ client.PayloadReader = (*Server)(nil)
+
+// New returns a server persisting its tasks in dir. Tasks which do not set an account are given accountID.
+func New(dir, inbox, accountID string) *Server {
+	return &Server{
+		dir:       dir,
+		inbox:     inbox,
+		accountID: accountID,
+		tasks:     map[string]*Task{},
+	}
+}
+
+// Start loads the tasks left over from a previous run and starts watching the inbox directory, if set.
+// Tasks which were running when the runner stopped are failed, they are not run again.
+func (s *Server) Start(ctx context.Context) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return errors.Wrap(err, "could not create standalone task directory")
+	}
+	if err := s.load(); err != nil {
+		return errors.Wrap(err, "could not load standalone tasks")
+	}
+	if s.inbox != "" {
+		if err := s.watch(ctx); err != nil {
+			return err
+		}
+	}
+	logger.Infof(ctx, "Started standalone task server at %s with %d tasks", s.dir, len(s.tasks))
+	return nil
+}
+
+// Submit queues a task request given in JSON. A timeout in seconds can be set in the task, as the manager does.
+func (s *Server) Submit(data []byte, source string) (*Task, error) {
+	var req *task.Request
+	if err := decodeOne(data, &req); err != nil {
+		return nil, errors.Wrap(err, "invalid task request")
+	}
+	if req == nil || req.Task == nil || req.Task.Type == "" {
+		return nil, errors.New("invalid task request: the task and its type are required")
+	}
+	var timeout struct {
+		Task struct {
+			Timeout int `json:"timeout"`
+		} `json:"task"`
+	}
+	if err := json.Unmarshal(data, &timeout); err != nil {
+		return nil, errors.Wrap(err, "invalid task request")
+	}
+	t := &Task{
+		ID:          req.ID,
+		Type:        req.Task.Type,
+		AccountID:   req.Account,
+		Source:      source,
+		State:       StateQueued,
+		Request:     req,
+		Timeout:     time.Duration(timeout.Task.Timeout) * time.Second,
+		SubmittedAt: time.Now(),
+	}
+	if t.ID == "" {
+		t.ID = uuid.New().String()
+	}
+	if t.AccountID == "" {
+		t.AccountID = s.accountID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tasks[t.ID]; ok {
+		return nil, errors.Errorf("task %s already exists", t.ID)
+	}
+	if err := s.write(t); err != nil {
+		return nil, err
+	}
+	s.tasks[t.ID] = t
+	return t.copy(), nil
+}
+
+// Get returns a task
+func (s *Server) Get(id string) (*Task, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return t.copy(), nil
+}
+
+// List returns the tasks in the given state, or all the tasks if state is empty, most recent first
+func (s *Server) List(state string) []*Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tasks := []*Task{}
+	for _, t := range s.tasks {
+		if state == "" || string(t.State) == state {
+			tasks = append(tasks, t.copy())
+		}
+	}
+	sort.Slice(tasks, func(a, b int) bool {
+		return tasks[a].SubmittedAt.After(tasks[b].SubmittedAt)
+	})
+	return tasks
+}
+
+// Register registers the runner, a new ID is given on every registration
+func (s *Server) Register(ctx context.Context, r *client.RegisterRequest) (*client.RegisterResponse, error) {
+	return &client.RegisterResponse{Resource: client.RegistrationData{DelegateID: uuid.New().String()}}, nil
+}
+
+// Heartbeat is a no-op, the runner and the server live in the same process
+func (s *Server) Heartbeat(ctx context.Context, r *client.RegisterRequest) error {
+	return nil
+}
+
+// Unregister is a no-op
+func (s *Server) Unregister(ctx context.Context, r *client.UnregisterRequest) error {
+	return nil
+}
+
+// GetRunnerEvents returns the queued tasks, oldest first. A task is returned until it's acquired.
+func (s *Server) GetRunnerEvents(ctx context.Context, delegateID string) (*client.RunnerEventsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var queued []*Task
+	for _, t := range s.tasks {
+		if t.State == StateQueued {
+			queued = append(queued, t)
+		}
+	}
+	sort.Slice(queued, func(a, b int) bool {
+		return queued[a].SubmittedAt.Before(queued[b].SubmittedAt)
+	})
+	events := &client.RunnerEventsResponse{RunnerEvents: []*client.RunnerEvent{}}
+	for _, t := range queued {
+		events.RunnerEvents = append(events.RunnerEvents, &client.RunnerEvent{
+			AccountID: t.AccountID,
+			TaskID:    t.ID,
+			TaskType:  t.Type,
+		})
+	}
+	return events, nil
+}
+
+// GetExecutionPayload acquires a queued task
+func (s *Server) GetExecutionPayload(ctx context.Context, delegateID, delegateName, taskID string) (*client.RunnerAcquiredTasks, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[taskID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if t.State != StateQueued {
+		return nil, errors.Errorf("task %s is already acquired", taskID)
+	}
+	now := time.Now()
+	t.State = StateRunning
+	t.StartedAt = &now
+	if err := s.write(t); err != nil {
+		return nil, err
+	}
+	return t.payloads(), nil
+}
+
+// ReadExecutionPayload returns the payload of a task without acquiring it
+func (s *Server) ReadExecutionPayload(ctx context.Context, taskID string) (*client.RunnerAcquiredTasks, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[taskID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return t.copy().payloads(), nil
+}
+
+// SendStatus records the response of a task. A task with several requests gets one response per request.
+func (s *Server) SendStatus(ctx context.Context, delegateID, taskID string, r *client.TaskResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[taskID]
+	if !ok {
+		return ErrNotFound
+	}
+	now := time.Now()
+	t.State = State(r.Code)
+	t.EndedAt = &now
+	t.Responses = append(t.Responses, r)
+	return s.write(t)
+}
+
+// SendProgress records the latest progress of a task
+func (s *Server) SendProgress(ctx context.Context, delegateID, taskID string, r *client.TaskProgress) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tasks[taskID]
+	if !ok {
+		return ErrNotFound
+	}
+	t.Progress = r
+	return s.write(t)
+}
+
+// ReconcileDaemonSets reports the daemon sets of the runner as expected, they are only
+// created and removed by tasks in standalone mode.
+func (s *Server) ReconcileDaemonSets(ctx context.Context, runnerID string, r *client.DaemonSetReconcileRequest) (*client.DaemonSetReconcileResponse, error) {
+	resp := &client.DaemonSetReconcileResponse{Data: []client.DaemonSetServerInfo{}}
+	for _, e := range r.Data {
+		resp.Data = append(resp.Data, client.DaemonSetServerInfo{
+			DaemonSetId: e.DaemonSetId,
+			Type:        e.Type,
+			Config:      e.Config,
+			SkipUpdate:  true,
+		})
+	}
+	return resp, nil
+}
+
+// AcquireDaemonTasks returns no task, daemon tasks are assigned by tasks in standalone mode
+func (s *Server) AcquireDaemonTasks(ctx context.Context, runnerID string, r *client.DaemonTaskAcquireRequest) (*client.RunnerAcquiredTasks, error) {
+	return &client.RunnerAcquiredTasks{}, nil
+}
+
+// GetLoggingToken is not supported, there is no remote logging without a manager
+func (s *Server) GetLoggingToken(ctx context.Context) (*client.AccessTokenBean, error) {
+	return nil, errNotSupported
+}
+
+// load reads the tasks persisted by a previous run. Must be called before the server is used.
+func (s *Server) load() error {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), fileExt) {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(s.dir, f.Name()))
+		if err != nil {
+			return err
+		}
+		t := new(Task)
+		if err := json.Unmarshal(b, t); err != nil {
+			return errors.Wrapf(err, "could not decode task %s", f.Name())
+		}
+		if t.State == StateRunning {
+			now := time.Now()
+			t.State = State(client.StatusCodeFailed)
+			t.EndedAt = &now
+			t.Responses = append(t.Responses, &client.TaskResponse{
+				ID:    t.ID,
+				Type:  t.Type,
+				Code:  client.StatusCodeFailed,
+				Error: "task was interrupted by a runner restart",
+			})
+			if err := s.write(t); err != nil {
+				return err
+			}
+		}
+		s.tasks[t.ID] = t
+	}
+	return nil
+}
+
+// write persists a task. Must be called with the lock held.
+func (s *Server) write(t *Task) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(filepath.Join(s.dir, url.PathEscape(t.ID)+fileExt), b)
+}
+
+// payloads returns the task as acquired by the runner
+func (t *Task) payloads() *client.RunnerAcquiredTasks {
+	return &client.RunnerAcquiredTasks{
+		Requests: []*task.Request{t.Request},
+		Timeouts: []time.Duration{t.Timeout},
+	}
+}
+
+// copy returns a deep copy of the task, so that it can be used without the lock
+func (t *Task) copy() *Task {
+	b, _ := json.Marshal(t)
+	c := new(Task)
+	_ = json.Unmarshal(b, c)
+	return c
+}
+
+// decodeOne decodes a single JSON value, anything after it fails the decoding
+func decodeOne(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(v); err != nil {
+		if err == io.EOF {
+			return errors.New("empty request")
+		}
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("a single task request is expected")
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package standalone
+
+import (
+	"path/filepath"
+
+	"github.com/google/wire"
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/delegateshell/delegate"
+)
+
+// WireSet is a Wire provider set that provides the client of the runner, backed by
+// the standalone server in standalone mode.
+var WireSet = wire.NewSet(
+	ProvideServer,
+	ProvideClient,
+)
+
+// ProvideServer is a Wire provider function that creates a standalone Server.
+func ProvideServer(
+	config *delegate.Config,
+) *Server {
+	dir := config.Standalone.Dir
+	if dir == "" {
+		dir = filepath.Join(config.CacheLocation, "standalone")
+	}
+	return New(dir, config.Standalone.Inbox, config.Delegate.AccountID)
+}
+
+// ProvideClient is a Wire provider function that returns the client the runner talks to:
+// the standalone server in standalone mode, the manager client otherwise.
+func ProvideClient(
+	config *delegate.Config,
+	managerClient *client.ManagerClient,
+	server *Server,
+) client.Client {
+	if config.Standalone.Enabled {
+		return server
+	}
+	return managerClient
+}
@@ -0,0 +1,24 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package stats
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handle registers the stats endpoint on the default mux: GET <endpoint> returns the same snapshot of the runner
+// as the one sent with the heartbeats.
+func (c *Collector) Handle(endpoint string) {
+	http.HandleFunc(endpoint, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(c.Snapshot(r.Context()))
+	})
+}
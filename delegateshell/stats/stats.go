@@ -0,0 +1,146 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package stats
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/drone-runners/drone-runner-aws/app/drivers"
+	"github.com/drone-runners/drone-runner-aws/types"
+	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/delegateshell/daemonset"
+	"github.com/harness/runner/logger"
+	"github.com/harness/runner/version"
+	"github.com/pkg/errors"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// The CPU utilization is averaged over at least this period, so that close snapshots give a stable figure
+var cpuSamplePeriod = 5 * time.Second
+
+// RunningFn returns the number of running tasks by task type
+type RunningFn func() map[string]int
+
+// Collector takes snapshots of the host and of the workload of the runner. The manager is given one with
+// every heartbeat, so that it can place the work on the least loaded runners.
+type Collector struct {
+	runnerName string
+	// path of the file system the disk usage is given for
+	diskPath         string
+	running          RunningFn
+	daemonSetManager *daemonset.DaemonSetManager
+	// pool manager and pools of a VM runner, nil otherwise
+	poolManager drivers.IManager
+	pools       []string
+
+	mu sync.Mutex
+	// CPU times of the last sample, and utilization since the sample before
+	cpuTimes   cpu.TimesStat
+	cpuPercent float64
+	cpuSampled time.Time
+}
+
+func New(runnerName, diskPath string, running RunningFn, daemonSetManager *daemonset.DaemonSetManager, poolManager drivers.IManager, pools []string) *Collector {
+	return &Collector{
+		runnerName:       runnerName,
+		diskPath:         diskPath,
+		running:          running,
+		daemonSetManager: daemonSetManager,
+		poolManager:      poolManager,
+		pools:            pools,
+	}
+}
+
+// Snapshot returns the current stats of the runner. The stats which can't be read are left out.
+func (c *Collector) Snapshot(ctx context.Context) *client.RunnerStats {
+	stats := &client.RunnerStats{
+		Version:      version.Version,
+		RunningTasks: c.running(),
+		CollectedAt:  time.Now().UnixMilli(),
+	}
+	if cpuPercent, err := c.cpuUtilization(ctx); err != nil {
+		logger.WithError(ctx, err).Debugln("could not get the CPU utilization")
+	} else {
+		stats.CPUPercent = cpuPercent
+	}
+	if virtualMemory, err := mem.VirtualMemoryWithContext(ctx); err != nil {
+		logger.WithError(ctx, err).Debugln("could not get the memory utilization")
+	} else {
+		stats.MemoryPercent = virtualMemory.UsedPercent
+	}
+	if usage, err := disk.UsageWithContext(ctx, c.diskPath); err != nil {
+		logger.WithError(ctx, err).Debugf("could not get the disk utilization of %s", c.diskPath)
+	} else {
+		stats.DiskPercent = usage.UsedPercent
+	}
+	stats.DaemonSets = c.daemonSets()
+	stats.Pools = c.poolAvailability(ctx)
+	return stats
+}
+
+// cpuUtilization returns the CPU utilization of the host between the last two samples, the first sample gives
+// the utilization since boot
+func (c *Collector) cpuUtilization(ctx context.Context) (float64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.cpuSampled.IsZero() && time.Since(c.cpuSampled) < cpuSamplePeriod {
+		return c.cpuPercent, nil
+	}
+	times, err := cpu.TimesWithContext(ctx, false)
+	if err != nil {
+		return 0, err
+	}
+	if len(times) == 0 {
+		return 0, errors.New("no CPU times")
+	}
+	total, busy := cpuBusy(times[0])
+	prevTotal, prevBusy := cpuBusy(c.cpuTimes)
+	if total > prevTotal {
+		c.cpuPercent = math.Min(100, math.Max(0, (busy-prevBusy)/(total-prevTotal)*100))
+	}
+	c.cpuTimes = times[0]
+	c.cpuSampled = time.Now()
+	return c.cpuPercent, nil
+}
+
+func cpuBusy(t cpu.TimesStat) (total, busy float64) {
+	total = t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+	return total, total - t.Idle - t.Iowait
+}
+
+func (c *Collector) daemonSets() []client.DaemonSetHealth {
+	var health []client.DaemonSetHealth
+	for _, ds := range c.daemonSetManager.GetAll() {
+		health = append(health, client.DaemonSetHealth{ID: ds.DaemonSetId, Type: ds.Type, Healthy: ds.Healthy})
+	}
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].Type < health[j].Type
+	})
+	return health
+}
+
+// poolAvailability returns the number of VMs of the pools of a VM runner, by state
+func (c *Collector) poolAvailability(ctx context.Context) []client.PoolAvailability {
+	if c.poolManager == nil {
+		return nil
+	}
+	var pools []client.PoolAvailability
+	for _, name := range c.pools {
+		busy, free, hibernating, err := c.poolManager.List(ctx, name, &types.QueryParams{RunnerName: c.runnerName})
+		if err != nil {
+			logger.WithError(ctx, err).Debugf("could not list the instances of pool %s", name)
+			continue
+		}
+		pools = append(pools, client.PoolAvailability{Name: name, Free: len(free), Busy: len(busy), Hibernating: len(hibernating)})
+	}
+	return pools
+}
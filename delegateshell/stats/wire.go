@@ -0,0 +1,31 @@
+package stats
+
+import (
+	"github.com/drone-runners/drone-runner-aws/app/drivers"
+	"github.com/google/wire"
+	"github.com/harness/runner/delegateshell/daemonset"
+	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/delegateshell/poller"
+)
+
+// WireSet is a Wire provider set that provides a Collector.
+var WireSet = wire.NewSet(
+	ProvideCollector,
+)
+
+// ProvideCollector is a Wire provider function that creates a Collector.
+func ProvideCollector(
+	config *delegate.Config,
+	poller *poller.Poller,
+	daemonSetManager *daemonset.DaemonSetManager,
+	poolManager drivers.IManager,
+) *Collector {
+	return New(
+		config.GetName(),
+		config.CacheLocation,
+		poller.RunningTasksByType,
+		daemonSetManager,
+		poolManager,
+		config.GetPoolNames(),
+	)
+}
@@ -12,7 +12,13 @@ import (
 	"github.com/harness/runner/delegateshell/daemonset"
 	"github.com/harness/runner/delegateshell/delegate"
 	"github.com/harness/runner/delegateshell/heartbeat"
+	"github.com/harness/runner/delegateshell/journal"
+	"github.com/harness/runner/delegateshell/lease"
+	"github.com/harness/runner/delegateshell/outbox"
 	"github.com/harness/runner/delegateshell/poller"
+	"github.com/harness/runner/delegateshell/shadow"
+	"github.com/harness/runner/delegateshell/standalone"
+	"github.com/harness/runner/delegateshell/stats"
 )
 
 var WireSet = wire.NewSet(
@@ -38,6 +44,12 @@ func ProvideDelegateShell(
 	downloader downloader.Downloader,
 	poller *poller.Poller,
 	keepAlive *heartbeat.KeepAlive,
+	outbox *outbox.Outbox,
+	journal *journal.Journal,
+	leases *lease.Store,
+	shadow *shadow.Shadow,
+	standalone *standalone.Server,
+	collector *stats.Collector,
 ) *DelegateShell {
 	return NewDelegateShell(
 		config,
@@ -48,5 +60,11 @@ func ProvideDelegateShell(
 		downloader,
 		poller,
 		keepAlive,
+		outbox,
+		journal,
+		leases,
+		shadow,
+		standalone,
+		collector,
 	)
 }
@@ -15,6 +15,7 @@ require (
 	github.com/drone/runner-go v1.12.0
 	github.com/google/uuid v1.6.0
 	github.com/google/wire v0.6.0
+	github.com/gorilla/websocket v1.5.0
 	github.com/harness/godotenv/v3 v3.0.1
 	github.com/harness/lite-engine v0.5.95
 	github.com/hashicorp/vault/api v1.12.2
@@ -29,9 +30,11 @@ require (
 	github.com/sirupsen/logrus v1.9.3
 	golang.org/x/oauth2 v0.23.0
 	golang.org/x/sync v0.8.0
+	golang.org/x/time v0.7.0
 	google.golang.org/api v0.203.0
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	gopkg.in/square/go-jose.v2 v2.6.0
+	software.sslmate.com/src/go-pkcs12 v0.5.0
 )
 
 require (
@@ -88,7 +91,6 @@ require (
 	github.com/google/s2a-go v0.1.8 // indirect
 	github.com/googleapis/enterprise-certificate-proxy v0.3.4 // indirect
 	github.com/googleapis/gax-go/v2 v2.13.0 // indirect
-	github.com/gorilla/websocket v1.5.0 // indirect
 	github.com/harness/godotenv/v2 v2.0.0 // indirect
 	github.com/harness/ti-client v0.0.0-20250211085345-7c82b29d1b3c // indirect
 	github.com/hashicorp/cronexpr v1.1.1 // indirect
@@ -156,7 +158,6 @@ require (
 	golang.org/x/net v0.30.0 // indirect
 	golang.org/x/sys v0.26.0 // indirect
 	golang.org/x/text v0.19.0 // indirect
-	golang.org/x/time v0.7.0 // indirect
 	golang.org/x/tools v0.21.1-0.20240508182429-e35e4ccd0d2d // indirect
 	google.golang.org/genproto v0.0.0-20241015192408-796eee8c2d53 // indirect
 	google.golang.org/genproto/googleapis/api v0.0.0-20241007155032-5fefd90f89a9 // indirect
@@ -2,21 +2,25 @@ package remotelogger
 
 import (
 	"context"
+	"strings"
 
 	"github.com/harness/runner/logger/remotelogger/gcplogger"
 
 	"github.com/harness/runner/logger"
 
 	"github.com/harness/runner/delegateshell/client"
+	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/utils"
 	"github.com/harness/runner/version"
 )
 
-func Start(ctx context.Context, accountId, managerEndpoint, runnerToken, serviceName, entityName string, remoteLoggingEnabled, insecure bool) {
+func Start(ctx context.Context, accountId string, managerEndpoints []string, tokens *delegate.TokenSource, serviceName, entityName string, remoteLoggingEnabled, insecure bool, cert *utils.ClientCertificate) {
 	if !remoteLoggingEnabled {
 		logger.Info(ctx, "Not pushing logs to remote. To enable remote logging, set environment variable ENABLE_REMOTE_LOGGING=true")
 		return
 	}
-	managerClient := client.NewManagerClient(managerEndpoint, accountId, runnerToken, insecure, "")
+	managerClient := client.NewManagerClient(managerEndpoints, accountId, tokens.Get(), insecure, "", cert)
+	tokens.Subscribe(managerClient.TokenCache.SetSecret)
 
 	err := gcplogger.Initialize(ctx, managerClient)
 	if err != nil {
@@ -27,7 +31,7 @@ func Start(ctx context.Context, accountId, managerEndpoint, runnerToken, service
 	// applied only to remote logging to avoid cluttering in other log output
 	logger.UpdateContextInHooks(map[string]string{
 		"accountId":  accountId,
-		"managerUrl": managerEndpoint,
+		"managerUrl": strings.Join(managerEndpoints, ","),
 		"service":    serviceName,
 		"version":    version.Version,
 		"name":       entityName})
@@ -10,11 +10,18 @@ type Metrics interface {
 	IncrementTaskFailedCount(accountID, taskType, runnerName string)
 	IncrementTaskRunningCount(accountID, taskType, runnerName string)
 	DecrementTaskRunningCount(accountID, taskType, runnerName string)
-	IncrementTaskTimeoutCount(accountID, taskType, runnerName string) // Not implemented
+	IncrementTaskTimeoutCount(accountID, taskType, runnerName string)
+	IncrementTaskRejectedCount(accountID, taskType, runnerName string)
 	SetTaskExecutionTime(accountID, taskType, runnerName, taskID string, executionTime float64)
+	ObserveTaskQueueTime(priorityClass, runnerName string, queueTime float64)
+	SetTaskLimiterQueueDepth(taskType, runnerName string, depth int)
+	IncrementTaskThrottledCount(accountID, taskType, runnerName string)
 	// Runner Metrics
 	IncrementHeartbeatFailureCount(accountID, runnerName string)
-	IncrementErrorCount(accountID, runnerName string)                      // Not implemented
+	IncrementReregistrationCount(accountID, reason, runnerName string)
+	IncrementErrorCount(accountID, runnerName string)
+	SetManagerEndpointActive(endpoint, runnerName string, active bool)
+	IncrementManagerRetryCount(request, decision, runnerName string)
 	SetResourceConsumptionIsAboveThreshold(accountID, runnerName string)   // Not implemented
 	UnsetResourceConsumptionIsAboveThreshold(accountID, runnerName string) // Not implemented
 }
@@ -24,16 +24,48 @@ func (p *PrometheusMetrics) IncrementTaskTimeoutCount(accountID, taskType, runne
 	p.TaskTimeoutCount.WithLabelValues(accountID, taskType, runnerName).Inc()
 }
 
+func (p *PrometheusMetrics) IncrementTaskRejectedCount(accountID, taskType, runnerName string) {
+	p.TaskRejectedCount.WithLabelValues(accountID, taskType, runnerName).Inc()
+}
+
 func (p *PrometheusMetrics) SetTaskExecutionTime(accountID, taskType, runnerName, taskID string, executionTime float64) {
 	p.TaskExecutionTime.WithLabelValues(accountID, taskType, taskID, runnerName).Set(executionTime)
 }
 
+func (p *PrometheusMetrics) ObserveTaskQueueTime(priorityClass, runnerName string, queueTime float64) {
+	p.TaskQueueTime.WithLabelValues(priorityClass, runnerName).Observe(queueTime)
+}
+
+func (p *PrometheusMetrics) SetTaskLimiterQueueDepth(taskType, runnerName string, depth int) {
+	p.TaskLimiterQueueDepth.WithLabelValues(taskType, runnerName).Set(float64(depth))
+}
+
+func (p *PrometheusMetrics) IncrementTaskThrottledCount(accountID, taskType, runnerName string) {
+	p.TaskThrottledCount.WithLabelValues(accountID, taskType, runnerName).Inc()
+}
+
 func (p *PrometheusMetrics) IncrementHeartbeatFailureCount(accountID, runnerName string) {
 	p.HeartbeatFailureCount.WithLabelValues(accountID, runnerName).Inc()
 }
 
+func (p *PrometheusMetrics) IncrementReregistrationCount(accountID, reason, runnerName string) {
+	p.ReregistrationCount.WithLabelValues(accountID, reason, runnerName).Inc()
+}
+
 func (p *PrometheusMetrics) IncrementErrorCount(accountID, runnerName string) {
-	p.TaskTimeoutCount.WithLabelValues(accountID, runnerName).Inc()
+	p.ErrorCount.WithLabelValues(accountID, runnerName).Inc()
+}
+
+func (p *PrometheusMetrics) SetManagerEndpointActive(endpoint, runnerName string, active bool) {
+	value := 0.0
+	if active {
+		value = 1
+	}
+	p.ManagerEndpointActive.WithLabelValues(endpoint, runnerName).Set(value)
+}
+
+func (p *PrometheusMetrics) IncrementManagerRetryCount(request, decision, runnerName string) {
+	p.ManagerRetryCount.WithLabelValues(request, decision, runnerName).Inc()
 }
 
 func (p *PrometheusMetrics) SetResourceConsumptionIsAboveThreshold(accountID, runnerName string) {
@@ -16,8 +16,14 @@ type PrometheusMetrics struct {
 	TaskRunningCount                  *prometheus.GaugeVec
 	TaskTimeoutCount                  *prometheus.CounterVec
 	TaskExecutionTime                 *prometheus.GaugeVec
+	TaskQueueTime                     *prometheus.HistogramVec
+	TaskLimiterQueueDepth             *prometheus.GaugeVec
+	TaskThrottledCount                *prometheus.CounterVec
 	HeartbeatFailureCount             *prometheus.CounterVec
+	ReregistrationCount               *prometheus.CounterVec
 	ErrorCount                        *prometheus.CounterVec
+	ManagerEndpointActive             *prometheus.GaugeVec
+	ManagerRetryCount                 *prometheus.CounterVec
 	TaskRejectedCount                 *prometheus.CounterVec
 	ResourceConsumptionAboveThreshold *prometheus.GaugeVec
 
@@ -77,6 +83,17 @@ func TaskTimeoutCount() *prometheus.CounterVec {
 	)
 }
 
+// TaskRejectedCount provides metrics for number of tasks rejected by the filter rules
+func TaskRejectedCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metrics.MetricNamePrefix + "_task_rejected_total",
+			Help: "Total number of tasks rejected by the runner filter rules",
+		},
+		[]string{"account_id", "task_type", "runner_name"},
+	)
+}
+
 // TaskExecutionTime provides metrics for the duration of task executions
 func TaskExecutionTime() *prometheus.GaugeVec {
 	return prometheus.NewGaugeVec(
@@ -88,6 +105,40 @@ func TaskExecutionTime() *prometheus.GaugeVec {
 	)
 }
 
+// TaskQueueTime provides metrics for the time tasks wait for a worker, by priority class
+func TaskQueueTime() *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    metrics.MetricNamePrefix + "_task_queue_time_seconds",
+			Help:    "Time tasks wait for a worker once acquired, by priority class",
+			Buckets: []float64{0.001, 0.01, 0.1, 0.5, 1, 5, 10, 30, 60},
+		},
+		[]string{"priority_class", "runner_name"},
+	)
+}
+
+// TaskLimiterQueueDepth provides metrics for the number of tasks waiting for the limits of their task type
+func TaskLimiterQueueDepth() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: metrics.MetricNamePrefix + "_task_limiter_queue_depth",
+			Help: "Number of tasks waiting for the concurrency or rate limit of their task type",
+		},
+		[]string{"task_type", "runner_name"},
+	)
+}
+
+// TaskThrottledCount provides metrics for number of tasks rejected by the limits of their task type
+func TaskThrottledCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metrics.MetricNamePrefix + "_task_throttled_total",
+			Help: "Total number of tasks rejected by the concurrency or rate limit of their task type",
+		},
+		[]string{"account_id", "task_type", "runner_name"},
+	)
+}
+
 func HeartbeatFailureCount() *prometheus.CounterVec {
 	return prometheus.NewCounterVec(
 		prometheus.CounterOpts{
@@ -98,6 +149,39 @@ func HeartbeatFailureCount() *prometheus.CounterVec {
 	)
 }
 
+// ReregistrationCount provides metrics for the registrations sent again once the manager lost the runner, by reason
+func ReregistrationCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metrics.MetricNamePrefix + "_runner_reregistration_total",
+			Help: "Total number of times the runner registered again after the manager lost its registration",
+		},
+		[]string{"account_id", "reason", "runner_name"},
+	)
+}
+
+// ManagerEndpointActive provides metrics for the endpoint of the manager the runner talks to, it's 1 for the active endpoint
+func ManagerEndpointActive() *prometheus.GaugeVec {
+	return prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: metrics.MetricNamePrefix + "_runner_manager_endpoint_active",
+			Help: "Whether the runner sends its requests to this endpoint of the manager",
+		},
+		[]string{"endpoint", "runner_name"},
+	)
+}
+
+// ManagerRetryCount provides metrics for the decisions taken on the failed requests to the manager, by request
+func ManagerRetryCount() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: metrics.MetricNamePrefix + "_runner_manager_request_retry_total",
+			Help: "Total number of failed requests to the manager, by request and by retry decision",
+		},
+		[]string{"request", "decision", "runner_name"},
+	)
+}
+
 // ErrorCount provides metrics for total errors in the system
 func ErrorCount() *prometheus.CounterVec {
 	return prometheus.NewCounterVec(
@@ -178,10 +262,17 @@ func registerMetrics() metrics.Metrics {
 	taskFailedCount := TaskFailedCount()
 	taskRunningCount := TaskRunningCount()
 	taskTimeoutCount := TaskTimeoutCount()
+	taskRejectedCount := TaskRejectedCount()
 	taskExecutionTime := TaskExecutionTime()
+	taskQueueTime := TaskQueueTime()
+	taskLimiterQueueDepth := TaskLimiterQueueDepth()
+	taskThrottledCount := TaskThrottledCount()
 	heartbeatFailureCount := HeartbeatFailureCount()
+	reregistrationCount := ReregistrationCount()
 	resourceConsumptionAboveThreshold := ResourceConsumptionAboveThreshold()
 	errorCount := ErrorCount()
+	managerEndpointActive := ManagerEndpointActive()
+	managerRetryCount := ManagerRetryCount()
 
 	// CI based metrics
 	pipelineExecutionCount := PipelineExecutionTotalCount()
@@ -194,7 +285,7 @@ func registerMetrics() metrics.Metrics {
 	pipelineMaxCPUPercentile := PipelineMaxCPUPercentile()
 	pipelineMaxMemoryPercentile := PipelineMaxMemoryPercentile()
 
-	prometheus.MustRegister(taskCompletedCount, taskFailedCount, taskRunningCount, taskTimeoutCount, taskExecutionTime, heartbeatFailureCount, resourceConsumptionAboveThreshold, errorCount,
+	prometheus.MustRegister(taskCompletedCount, taskFailedCount, taskRunningCount, taskTimeoutCount, taskRejectedCount, taskExecutionTime, taskQueueTime, taskLimiterQueueDepth, taskThrottledCount, heartbeatFailureCount, reregistrationCount, resourceConsumptionAboveThreshold, errorCount, managerEndpointActive, managerRetryCount,
 		pipelineExecutionCount, pipelineExecutionErrorsCount, pipelineExecutionsRunning, pipelineExecutionsRunningPerAccount, pipelinePoolFallbackCount, pipelineWaitDurationTime,
 		pipelineMaxCPUPercentile, pipelineMaxMemoryPercentile, pipelineSystemErrorsTotalCount)
 	return &PrometheusMetrics{
@@ -202,9 +293,16 @@ func registerMetrics() metrics.Metrics {
 		TaskFailedCount:                     taskFailedCount,
 		TaskRunningCount:                    taskRunningCount,
 		TaskTimeoutCount:                    taskTimeoutCount,
+		TaskRejectedCount:                   taskRejectedCount,
 		TaskExecutionTime:                   taskExecutionTime,
+		TaskQueueTime:                       taskQueueTime,
+		TaskLimiterQueueDepth:               taskLimiterQueueDepth,
+		TaskThrottledCount:                  taskThrottledCount,
 		HeartbeatFailureCount:               heartbeatFailureCount,
+		ReregistrationCount:                 reregistrationCount,
 		ErrorCount:                          errorCount,
+		ManagerEndpointActive:               managerEndpointActive,
+		ManagerRetryCount:                   managerRetryCount,
 		ResourceConsumptionAboveThreshold:   resourceConsumptionAboveThreshold,
 		PipelineSystemErrorsTotalCount:      pipelineSystemErrorsTotalCount,
 		PipelineExecutionTotalCount:         pipelineExecutionCount,
@@ -0,0 +1,158 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package limiter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/drone/go-task/task"
+	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/logger"
+	"github.com/harness/runner/metrics"
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// ErrLimitExceeded is the failure of a task which could not get through the limits of its task type
+var ErrLimitExceeded = errors.New("task rejected by the runner limits")
+
+// limiter holds the admission control of a task type
+type limiter struct {
+	taskType string
+	// nil if the concurrency is not limited
+	slots chan struct{}
+	// nil if the rate is not limited
+	rate     *rate.Limiter
+	maxWait  time.Duration
+	maxQueue int
+
+	mu     sync.Mutex
+	queued int
+}
+
+func newLimiter(taskType string, config delegate.LimitConfig) *limiter {
+	l := &limiter{taskType: taskType, maxWait: config.MaxWait, maxQueue: config.MaxQueue}
+	if config.MaxConcurrency > 0 {
+		l.slots = make(chan struct{}, config.MaxConcurrency)
+	}
+	if config.Rate > 0 {
+		burst := config.Burst
+		if burst <= 0 {
+			burst = 1
+		}
+		l.rate = rate.NewLimiter(rate.Limit(config.Rate), burst)
+	}
+	return l
+}
+
+// Middleware limits the number of tasks of a type running at the same time, and the rate at which
+// they start. A task waits in the queue of its type for up to the max wait of the type, it's failed
+// with ErrLimitExceeded if it can't start by then or if the queue is full.
+func Middleware(limits map[string]delegate.LimitConfig, m metrics.Metrics, accountID, runnerName string) func(next task.Handler) task.Handler {
+	limiters := map[string]*limiter{}
+	for taskType, config := range limits {
+		if config.MaxConcurrency > 0 || config.Rate > 0 {
+			limiters[taskType] = newLimiter(taskType, config)
+		}
+	}
+	return func(next task.Handler) task.Handler {
+		fn := func(ctx context.Context, req *task.Request) task.Response {
+			if req.Task == nil {
+				return next.Handle(ctx, req)
+			}
+			l, ok := limiters[req.Task.Type]
+			if !ok {
+				return next.Handle(ctx, req)
+			}
+			release, err := l.acquire(ctx, func(depth int) {
+				m.SetTaskLimiterQueueDepth(l.taskType, runnerName, depth)
+			})
+			if err != nil {
+				if errors.Is(err, ErrLimitExceeded) {
+					logger.WithError(ctx, err).WithField("task_type", l.taskType).Warnln("task rejected by the limits of its task type")
+					m.IncrementTaskThrottledCount(accountID, l.taskType, runnerName)
+				}
+				return task.Error(err)
+			}
+			defer release()
+			return next.Handle(ctx, req)
+		}
+		return task.HandlerFunc(fn)
+	}
+}
+
+// acquire waits for a slot and a rate token. It returns the function releasing the slot.
+// Only the tasks which have to wait are queued, depth is called with the number of waiting tasks when it changes.
+func (l *limiter) acquire(ctx context.Context, depth func(int)) (func(), error) {
+	release := func() {}
+	slot := l.slots == nil
+	if !slot {
+		select {
+		case l.slots <- struct{}{}:
+			slot = true
+			release = func() { <-l.slots }
+		default:
+		}
+	}
+	// The rate token is only taken once the slot is, a task waiting for a slot must not hold a token
+	if slot && (l.rate == nil || l.rate.Allow()) {
+		return release, nil
+	}
+
+	if !l.enqueue(depth) {
+		release()
+		return nil, errors.Wrapf(ErrLimitExceeded, "%d tasks of type %s are already waiting", l.maxQueue, l.taskType)
+	}
+	defer l.dequeue(depth)
+
+	// A zero max wait does not wait at all, the config gives the task types a default one
+	waitCtx, cancel := context.WithTimeout(ctx, l.maxWait)
+	defer cancel()
+	if !slot {
+		select {
+		case l.slots <- struct{}{}:
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return nil, context.Cause(ctx)
+			}
+			return nil, errors.Wrapf(ErrLimitExceeded, "%d tasks of type %s are already running, no slot freed up within %s",
+				cap(l.slots), l.taskType, l.maxWait)
+		}
+		release = func() { <-l.slots }
+		if l.rate == nil || l.rate.Allow() {
+			return release, nil
+		}
+	}
+	if err := l.rate.Wait(waitCtx); err != nil {
+		release()
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		return nil, errors.Wrapf(ErrLimitExceeded, "tasks of type %s are limited to %v per second, no token within %s",
+			l.taskType, l.rate.Limit(), l.maxWait)
+	}
+	return release, nil
+}
+
+func (l *limiter) enqueue(depth func(int)) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxQueue > 0 && l.queued >= l.maxQueue {
+		return false
+	}
+	l.queued++
+	depth(l.queued)
+	return true
+}
+
+func (l *limiter) dequeue(depth func(int)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.queued--
+	depth(l.queued)
+}
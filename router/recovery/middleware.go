@@ -0,0 +1,43 @@
+// Copyright 2021 Harness Inc. All rights reserved.
+// Use of this source code is governed by the PolyForm Shield 1.0.0 license
+// that can be found in the licenses directory at the root of this repository, also available at
+// https://polyformproject.org/wp-content/uploads/2020/06/PolyForm-Shield-1.0.0.txt.
+
+package recovery
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+
+	"github.com/drone/go-task/task"
+	"github.com/harness/runner/logger"
+	"github.com/harness/runner/metrics"
+)
+
+// The panic value may carry anything, including secrets, so it's only logged and never sent to the manager
+var errPanic = errors.New("the task failed with an internal error on the runner")
+
+// Middleware recovers from panics in the task handlers, so that a failing task does not take down
+// the whole runner along with the other tasks. The panic is reported as a failed task.
+// Panics in goroutines started by the handlers are not recovered.
+func Middleware(m metrics.Metrics, accountID, runnerName string) func(next task.Handler) task.Handler {
+	return func(next task.Handler) task.Handler {
+		fn := func(ctx context.Context, req *task.Request) (resp task.Response) {
+			defer func() {
+				if r := recover(); r != nil {
+					taskType := ""
+					if req.Task != nil {
+						taskType = req.Task.Type
+					}
+					logger.WithField(ctx, "task_type", taskType).
+						Errorf("recovered from panic in task handler: %v\n%s", r, debug.Stack())
+					m.IncrementErrorCount(accountID, runnerName)
+					resp = task.Error(errPanic)
+				}
+			}()
+			return next.Handle(ctx, req)
+		}
+		return task.HandlerFunc(fn)
+	}
+}
@@ -16,6 +16,9 @@ import (
 	"github.com/harness/runner/delegateshell/daemonset"
 	"github.com/harness/runner/delegateshell/delegate"
 	"github.com/harness/runner/logger/logstream"
+	"github.com/harness/runner/metrics"
+	"github.com/harness/runner/router/limiter"
+	"github.com/harness/runner/router/recovery"
 	"github.com/harness/runner/tasks/daemontask"
 	"github.com/harness/runner/tasks/delegatetask"
 	"github.com/harness/runner/tasks/local"
@@ -24,16 +27,79 @@ import (
 	"github.com/harness/runner/tasks/vm"
 )
 
-func convert(config *delegate.Config) *delegate.TaskContext {
+// Task types with a dedicated handler. The other task types are run by the cgi driver.
+const (
+	TaskLocalInit       = "local_init"
+	TaskLocalExecute    = "local_execute"
+	TaskLocalCleanup    = "local_cleanup"
+	TaskVaultFetch      = "secret/vault/fetch"
+	TaskVaultEdit       = "secret/vault/edit"
+	TaskDelegateTask    = "delegate_task"
+	TaskStaticSecret    = "secret/static"
+	TaskVMInit          = "vm_init"
+	TaskVMExecute       = "vm_execute"
+	TaskVMCleanup       = "vm_cleanup"
+	TaskDaemonSetUpsert = "daemonset/upsert"
+	TaskDaemonSetAssign = "daemonset/tasks/assign"
+)
+
+// dependencies are what the handlers are built from
+type dependencies struct {
+	taskContext     *delegate.TaskContext
+	dsManager       *daemonset.DaemonSetManager
+	poolManager     drivers.IManager
+	stageOwnerStore store.StageOwnerStore
+	vmmetrics       *metric.Metrics
+}
+
+// routes builds the handler of each task type with a dedicated handler. The router registers them, and
+// HasHandler answers from them, so that the two cannot drift apart.
+var routes = map[string]func(d *dependencies) task.Handler{
+	TaskLocalInit:    func(d *dependencies) task.Handler { return local.NewSetupHandler(d.taskContext) },
+	TaskLocalExecute: func(*dependencies) task.Handler { return task.HandlerFunc(local.ExecHandler) },
+	TaskLocalCleanup: func(*dependencies) task.Handler { return task.HandlerFunc(local.DestroyHandler) },
+	TaskVaultFetch:   func(*dependencies) task.Handler { return task.HandlerFunc(vault.FetchHandler) },
+	TaskVaultEdit:    func(*dependencies) task.Handler { return task.HandlerFunc(vault.Handler) },
+	TaskDelegateTask: func(d *dependencies) task.Handler { return delegatetask.NewDelegateTaskHandler(d.taskContext) },
+	TaskStaticSecret: func(*dependencies) task.Handler { return new(secrets.StaticSecretHandler) },
+
+	// VM tasks
+	TaskVMInit: func(d *dependencies) task.Handler {
+		return vm.NewSetupHandler(d.taskContext, d.poolManager, d.stageOwnerStore, d.vmmetrics)
+	},
+	TaskVMExecute: func(d *dependencies) task.Handler {
+		return vm.NewExecHandler(d.taskContext, d.poolManager, d.stageOwnerStore, d.vmmetrics)
+	},
+	TaskVMCleanup: func(d *dependencies) task.Handler {
+		return vm.NewCleanupHandler(d.poolManager, d.stageOwnerStore, d.vmmetrics)
+	},
+
+	TaskDaemonSetUpsert: func(d *dependencies) task.Handler {
+		return task.HandlerFunc(daemontask.NewDaemonSetTaskHandler(d.dsManager).HandleUpsert)
+	},
+	TaskDaemonSetAssign: func(d *dependencies) task.Handler {
+		return task.HandlerFunc(daemontask.NewDaemonSetTaskHandler(d.dsManager).HandleTaskAssign)
+	},
+}
+
+// HasHandler tells whether the router has a dedicated handler for the task type
+func HasHandler(taskType string) bool {
+	_, ok := routes[taskType]
+	return ok
+}
+
+func convert(config *delegate.Config, tokens *delegate.TokenSource) *delegate.TaskContext {
 	return &delegate.TaskContext{
 		AccountID:              config.Delegate.AccountID,
 		DelegateName:           config.GetName(),
-		Token:                  config.GetToken(),
-		DelegateId:             &config.Delegate.ID,
+		Token:                  tokens.Get(),
+		Tokens:                 tokens,
+		DelegateID:             config.GetDelegateID,
 		DelegateTaskServiceURL: config.Delegate.TaskServiceURL,
 		RunnerType:             config.GetRunnerType(),
 		SkipVerify:             config.Server.Insecure,
 		ManagerEndpoint:        config.GetHarnessUrl(),
+		ClientCertificate:      config.GetClientCertificate(),
 		PoolMapperByAccount:    config.VM.Pool.MapByAccountID.Convert(),
 	}
 }
@@ -46,26 +112,26 @@ func NewRouter(
 	poolManager drivers.IManager,
 	stageOwnerStore store.StageOwnerStore,
 	vmmetrics *metric.Metrics,
+	m metrics.Metrics,
+	limits map[string]delegate.LimitConfig,
 ) *task.Router {
 	r := task.NewRouter()
+	// The recovery middleware comes first so that it wraps all the others
+	r.Use(recovery.Middleware(m, taskContext.AccountID, taskContext.DelegateName))
+	// Tasks waiting for their limits do not hold anything else, e.g. a log stream
+	r.Use(limiter.Middleware(limits, m, taskContext.AccountID, taskContext.DelegateName))
 	r.Use(logstream.Middleware())
 
-	r.Register("local_init", local.NewSetupHandler(taskContext))
-	r.RegisterFunc("local_execute", local.ExecHandler)
-	r.RegisterFunc("local_cleanup", local.DestroyHandler)
-	r.RegisterFunc("secret/vault/fetch", vault.FetchHandler)
-	r.RegisterFunc("secret/vault/edit", vault.Handler)
-	r.Register("delegate_task", delegatetask.NewDelegateTaskHandler(taskContext))
-	r.Register("secret/static", new(secrets.StaticSecretHandler))
-
-	// VM tasks
-	r.Register("vm_init", vm.NewSetupHandler(taskContext, poolManager, stageOwnerStore, vmmetrics))
-	r.Register("vm_execute", vm.NewExecHandler(taskContext, poolManager, stageOwnerStore, vmmetrics))
-	r.Register("vm_cleanup", vm.NewCleanupHandler(poolManager, stageOwnerStore, vmmetrics))
-
-	daemonSetTaskHandler := daemontask.NewDaemonSetTaskHandler(dsManager)
-	r.RegisterFunc("daemonset/upsert", daemonSetTaskHandler.HandleUpsert)
-	r.RegisterFunc("daemonset/tasks/assign", daemonSetTaskHandler.HandleTaskAssign)
+	deps := &dependencies{
+		taskContext:     taskContext,
+		dsManager:       dsManager,
+		poolManager:     poolManager,
+		stageOwnerStore: stageOwnerStore,
+		vmmetrics:       vmmetrics,
+	}
+	for taskType, handler := range routes {
+		r.Register(taskType, handler(deps))
+	}
 
 	r.NotFound(cgi.New(d, pl))
 	return r
@@ -10,6 +10,7 @@ import (
 	"github.com/google/wire"
 	"github.com/harness/runner/delegateshell/daemonset"
 	"github.com/harness/runner/delegateshell/delegate"
+	"github.com/harness/runner/metrics"
 )
 
 var WireSet = wire.NewSet(
@@ -18,12 +19,14 @@ var WireSet = wire.NewSet(
 
 func ProvideRouter(
 	config *delegate.Config,
+	tokens *delegate.TokenSource,
 	d downloader.Downloader,
 	pl packaged.PackageLoader,
 	dsManager *daemonset.DaemonSetManager,
 	poolManager drivers.IManager,
 	stageOwnerStore store.StageOwnerStore,
 	vmmetrics *metric.Metrics,
+	m metrics.Metrics,
 ) *task.Router {
-	return NewRouter(convert(config), d, pl, dsManager, poolManager, stageOwnerStore, vmmetrics)
+	return NewRouter(convert(config, tokens), d, pl, dsManager, poolManager, stageOwnerStore, vmmetrics, m, config.GetLimitsConfig())
 }
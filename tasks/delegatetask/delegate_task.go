@@ -37,7 +37,7 @@ func (h *DelegateTaskHandler) Handle(ctx context.Context, req *task.Request) tas
 	}
 	dst = dst[:n]
 
-	if err = SendTask(ctx, dst, h.taskContext.DelegateTaskServiceURL, h.taskContext.SkipVerify); err != nil {
+	if err = SendTask(ctx, dst, h.taskContext.DelegateTaskServiceURL, h.taskContext.SkipVerify, h.taskContext.ClientCertificate); err != nil {
 		logger.WithError(ctx, err).Error("Send request to delegate task service failed")
 		return task.Error(err)
 	}
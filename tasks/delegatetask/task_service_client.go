@@ -13,9 +13,9 @@ import (
 var once sync.Once
 var client Client
 
-func SendTask(ctx context.Context, data []byte, url string, skipVerify bool) error {
+func SendTask(ctx context.Context, data []byte, url string, skipVerify bool, cert *utils.ClientCertificate) error {
 	once.Do(func() {
-		client = NewTaskServiceClient(url, skipVerify, "")
+		client = NewTaskServiceClient(url, skipVerify, "", cert)
 	})
 	return client.SendTask(ctx, data)
 }
@@ -28,9 +28,9 @@ type TaskServiceClient struct {
 	utils.HTTPClient
 }
 
-func NewTaskServiceClient(endpoint string, skipVerify bool, additionalCertsDir string) *TaskServiceClient {
+func NewTaskServiceClient(endpoint string, skipVerify bool, additionalCertsDir string, cert *utils.ClientCertificate) *TaskServiceClient {
 	return &TaskServiceClient{
-		HTTPClient: *utils.New(endpoint, skipVerify, additionalCertsDir),
+		HTTPClient: *utils.NewWithClientCertificate(endpoint, skipVerify, additionalCertsDir, cert),
 	}
 }
 
@@ -4,17 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"runtime"
+	"time"
 
 	"github.com/drone/go-task/task"
 	"github.com/harness/lite-engine/api"
 	"github.com/harness/lite-engine/engine/spec"
 	logger "github.com/harness/lite-engine/logstream"
 	run "github.com/harness/lite-engine/pipeline/runtime"
+	"github.com/harness/runner/delegateshell/progress"
 	runnerLogger "github.com/harness/runner/logger"
 	"github.com/harness/runner/logger/logstream"
 	"github.com/harness/runner/tasks/local/utils"
 )
 
+var (
+	stepCleanupTimeout = 1 * time.Minute
+)
+
 func ExecHandler(ctx context.Context, req *task.Request) task.Response {
 	// unmarshal req.Task.Data into tasks.SetupRequest
 	executeRequest := new(ExecRequest)
@@ -26,9 +32,16 @@ func ExecHandler(ctx context.Context, req *task.Request) task.Response {
 	// Wrap the io.Writer to convert it into a logstream.Writer which is used by the lite-engine.
 	logWriter := logstream.NewWriterWrapper(req.Logger)
 	logWriter.Open()
+	// Steps can run for a long time, let the manager know that the step is alive while it runs
+	progress.Report(ctx, "executing", progress.Unknown, "step "+executeRequest.ID+" is running")
 	// no need to close logWriter here, because
 	// lite-engine's stepExecutor takes care of calling `logWriter.Close()`
 	resp, err := HandleExec(ctx, executeRequest, logWriter)
+	if ctx.Err() != nil {
+		// The task was aborted, make sure the step container does not outlive it
+		killStepContainer(ctx, executeRequest)
+		return task.Error(context.Cause(ctx))
+	}
 	if err != nil {
 		runnerLogger.Error(ctx, "could not handle exec request: %w", err)
 		return task.Error(err)
@@ -42,6 +55,23 @@ func ExecHandler(ctx context.Context, req *task.Request) task.Response {
 	return task.Respond(respBytes)
 }
 
+// killStepContainer kills and removes the container created for the step.
+// Containers created by the lite engine are named after the step ID.
+func killStepContainer(ctx context.Context, s *ExecRequest) {
+	runnerLogger.WithField(ctx, "step_id", s.ID).Infoln("killing step container")
+	docker, err := utils.GetDockerClient()
+	if err != nil {
+		runnerLogger.WithError(ctx, err).Errorln("could not get docker client to kill step container")
+		return
+	}
+	// The task's context is already cancelled at this point
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), stepCleanupTimeout)
+	defer cancel()
+	if err := docker.KillContainers(cleanupCtx, []string{s.ID}); err != nil {
+		runnerLogger.WithError(ctx, err).Warnln("could not kill step container")
+	}
+}
+
 func (s *ExecRequest) Sanitize() {
 	s.Network = utils.Sanitize(s.Network)
 	s.GroupID = utils.Sanitize(s.GroupID)
@@ -37,10 +37,7 @@ func (h *SetupHandler) Handle(ctx context.Context, req *task.Request) task.Respo
 	}
 	logWriter := logstream.NewWriterWrapper(req.Logger)
 	logWriter.Open()
-	var delegateID string
-	if h.taskContext.DelegateId != nil {
-		delegateID = *h.taskContext.DelegateId
-	}
+	delegateID := h.taskContext.GetDelegateID()
 	// TODO: remove this after delegate id no longer needed from setup request
 	resp, err := HandleSetup(ctx, setupRequest, delegateID, logWriter)
 	logWriter.Close()
@@ -90,15 +90,12 @@ func (h *ExecHandler) Handle(ctx context.Context, req *task.Request) task.Respon
 	}
 	execRequest.Request.Secrets = append(execRequest.Request.Secrets, secrets...)
 	// Generate a token so that the task can send back the response back to the manager directly
-	token, err := delegate.Token(audience, issuer, h.taskContext.AccountID, h.taskContext.Token, 10*time.Hour+tokenExpiryOffset)
+	token, err := delegate.Token(audience, issuer, h.taskContext.AccountID, h.taskContext.GetToken(), 10*time.Hour+tokenExpiryOffset)
 	if err != nil {
 		return task.Respond(failedResponse(err.Error()))
 	}
 
-	var delegateID string
-	if h.taskContext.DelegateId != nil {
-		delegateID = *h.taskContext.DelegateId
-	}
+	delegateID := h.taskContext.GetDelegateID()
 	execRequest.Request.StepStatus = api.StepStatusConfig{
 		Endpoint:   h.taskContext.ManagerEndpoint,
 		AccountID:  h.taskContext.AccountID,
@@ -119,6 +116,12 @@ func (h *ExecHandler) Handle(ctx context.Context, req *task.Request) task.Respon
 	}
 
 	pollStepResp, err := harness.HandleStep(ctx, execVMRequest, h.stageOwnerStore, []string{}, false, 0, h.poolManager, h.metrics, async)
+	if ctx.Err() != nil {
+		// The task was aborted while the step was being submitted or polled.
+		// The stage resources on the VM are released by the vm_cleanup task.
+		logger.WithError(ctx, context.Cause(ctx)).Warnln("vm step execution was interrupted")
+		return task.Error(context.Cause(ctx))
+	}
 	if err != nil {
 		return task.Respond(failedResponse(err.Error()))
 	}
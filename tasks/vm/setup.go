@@ -136,15 +136,12 @@ func (h *SetupHandler) Handle(ctx context.Context, req *task.Request) task.Respo
 		return task.Respond(failedResponse(err.Error()))
 	}
 
-	var delegateID string
-	if h.taskContext.DelegateId != nil {
-		delegateID = *h.taskContext.DelegateId
-	}
+	delegateID := h.taskContext.GetDelegateID()
 	serviceStatuses := []VMServiceStatus{}
 	if len(setupRequest.Services) > 0 {
 		var status VMServiceStatus
 		// Generate a token so that the task can send back the response back to the manager directly
-		token, err := delegate.Token(audience, issuer, h.taskContext.AccountID, h.taskContext.Token, 10*time.Hour+tokenExpiryOffset)
+		token, err := delegate.Token(audience, issuer, h.taskContext.AccountID, h.taskContext.GetToken(), 10*time.Hour+tokenExpiryOffset)
 		if err != nil {
 			return task.Respond(failedResponse(err.Error()))
 		}
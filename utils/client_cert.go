@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/harness/runner/logger"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// ClientCertificate is the certificate presented by the runner to the servers requiring mutual TLS. It's read from
+// a PEM certificate and key pair, or from a PKCS#12 bundle, and read again whenever the files change on disk, so
+// that rotated certificates are picked up by the next connection.
+type ClientCertificate struct {
+	CertFile       string
+	KeyFile        string
+	PKCS12File     string
+	PKCS12Password string
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+	// modification times of the files the certificate was read from
+	modTimes []time.Time
+}
+
+// NewClientCertificate returns the client certificate read from a PEM pair, or from a PKCS#12 bundle if certFile is
+// empty. It returns nil if neither is set. The files are read on first use, see Load.
+func NewClientCertificate(certFile, keyFile, pkcs12File, pkcs12Password string) *ClientCertificate {
+	if certFile == "" && pkcs12File == "" {
+		return nil
+	}
+	return &ClientCertificate{CertFile: certFile, KeyFile: keyFile, PKCS12File: pkcs12File, PKCS12Password: pkcs12Password}
+}
+
+// Load returns the certificate, it reads the files again if they changed since they were last read. If the new
+// files can't be used, e.g. because they are being rotated, the previous certificate is kept.
+func (c *ClientCertificate) Load() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	modTimes, err := c.stat()
+	if err == nil && c.cert != nil && equalTimes(modTimes, c.modTimes) {
+		return c.cert, nil
+	}
+	var cert *tls.Certificate
+	if err == nil {
+		cert, err = c.read()
+	}
+	if err != nil {
+		if c.cert != nil {
+			logger.WithError(context.Background(), err).Warnln("could not reload the client certificate, keeping the previous one")
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	if c.cert != nil {
+		logger.Infof(context.Background(), "reloaded the client certificate %s", c.files()[0])
+	}
+	c.cert = cert
+	c.modTimes = modTimes
+	return cert, nil
+}
+
+// GetClientCertificate is used as the tls.Config callback, the certificate is checked for changes on every handshake
+func (c *ClientCertificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.Load()
+}
+
+func (c *ClientCertificate) files() []string {
+	if c.CertFile != "" {
+		return []string{c.CertFile, c.KeyFile}
+	}
+	return []string{c.PKCS12File}
+}
+
+func (c *ClientCertificate) stat() ([]time.Time, error) {
+	var modTimes []time.Time
+	for _, f := range c.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+func (c *ClientCertificate) read() (*tls.Certificate, error) {
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate %s: %w", c.CertFile, err)
+		}
+		return &cert, nil
+	}
+	data, err := os.ReadFile(c.PKCS12File)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := decodePKCS12(data, c.PKCS12Password)
+	if err != nil {
+		return nil, fmt.Errorf("could not load client certificate bundle %s: %w", c.PKCS12File, err)
+	}
+	return cert, nil
+}
+
+// decodePKCS12 decodes a PKCS#12 bundle holding a private key, the certificate of the key and optionally the
+// intermediate certificates of its chain. Bundles encrypted with the legacy algorithms and with the modern ones
+// (PBES2, AES) are both supported.
+func decodePKCS12(data []byte, password string) (*tls.Certificate, error) {
+	key, leaf, chain, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, err
+	}
+	cert := &tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: leaf}
+	for _, c := range chain {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	return cert, nil
+}
+
+func equalTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
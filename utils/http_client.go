@@ -36,6 +36,16 @@ func New(endpoint string, skipverify bool, additionalCertsDir string) *HTTPClien
 	return getClient(endpoint, skipverify, additionalCertsDir)
 }
 
+// NewWithClientCertificate returns a new client presenting a certificate to the servers requiring mutual TLS.
+// A nil certificate returns the same client as New.
+func NewWithClientCertificate(endpoint string, skipverify bool, additionalCertsDir string, cert *ClientCertificate) *HTTPClient {
+	c := getClient(endpoint, skipverify, additionalCertsDir)
+	if cert != nil {
+		c.Client = clientWithCertificate(c.Client, cert)
+	}
+	return c
+}
+
 func getClient(endpoint string, skipverify bool, additionalCertsDir string) *HTTPClient {
 	c := &HTTPClient{
 		Endpoint:   endpoint,
@@ -115,6 +125,24 @@ func clientWithRootCAs(skipverify bool, rootCAs *x509.CertPool) *http.Client {
 	}
 }
 
+// clientWithCertificate returns a copy of the client which presents the certificate during the TLS handshakes
+func clientWithCertificate(c *http.Client, cert *ClientCertificate) *http.Client {
+	transport, ok := c.Transport.(*http.Transport)
+	if ok {
+		transport = transport.Clone()
+	} else {
+		transport = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.GetClientCertificate = cert.GetClientCertificate
+	return &http.Client{
+		CheckRedirect: c.CheckRedirect,
+		Transport:     transport,
+	}
+}
+
 // do is a helper function that posts a signed http request with
 // the input encoded and response decoded from json.
 func (p *HTTPClient) Do(ctx context.Context, path, method string, headers map[string]string, in *bytes.Buffer) (*http.Response, []byte, error) {